@@ -10,16 +10,45 @@ package donna
 
 import (
 	`encoding/binary`
+	`fmt`
+	`io/ioutil`
 	`math/rand`
-	`os`
+	`path/filepath`
 	`sort`
+	`strings`
 	`time`
 )
 
-// Many pages make a thick book.
+// Book move selection policies.
+const (
+	BookUniform = iota 	// Random pick among the top moves.
+	BookBest 		// Always the move with the highest weight.
+	BookWeighted 		// Random pick with odds proportional to the weights.
+)
+
+// Policy names as they appear in UCI options and REPL commands.
+var bookPolicies = [...]string{ `uniform`, `best`, `weighted` }
+
+// How to pick the move among book entries for the position.
+type BookPolicy struct {
+	kind       int   	// BookUniform, BookBest, or BookWeighted.
+	top        int   	// Number of best moves to pick from uniformly.
+	minWeight  int   	// Entries with lower weight are never picked.
+	seed       int64 	// Random seed, or 0 to seed with current time.
+}
+
+// Picks randomly among two best moves.
+var defaultBookPolicy = BookPolicy{ kind: BookUniform, top: 2 }
+
+// Many pages make a thick book. The whole book gets loaded into memory once,
+// and so do its learning values.
 type Book struct {
 	fileName string
-	entries  int64
+	entries  []Entry       // Book entries sorted by polyglot key.
+	policy   BookPolicy
+	random   *rand.Rand
+	learning BookLearning  // Learning values loaded from the sidecar file.
+	learn    bool          // Adjust the weights by learning values.
 }
 
 // Opening book record: the fields are exported for binary.Read().
@@ -31,74 +60,159 @@ type Entry struct {
 }
 
 func NewBook(bookFile string) (*Book, error) {
-	book := &Book{fileName: bookFile}
+	book := &Book{fileName: bookFile, policy: defaultBookPolicy}
 
-	if fi, err := os.Stat(book.fileName); err != nil {
+	content, err := ioutil.ReadFile(book.fileName)
+	if err != nil {
 		return nil, err
-	} else {
-		book.entries = fi.Size() / 16
 	}
+	book.entries = make([]Entry, len(content) / 16)
+	for i := range book.entries {
+		record := content[i * 16:]
+		book.entries[i] = Entry{
+			Key:   binary.BigEndian.Uint64(record[0:8]),
+			Move:  binary.BigEndian.Uint16(record[8:10]),
+			Score: binary.BigEndian.Uint16(record[10:12]),
+			Learn: binary.BigEndian.Uint32(record[12:16]),
+		}
+	}
+
+	if book.learning, err = LoadBookLearning(learningFile(bookFile)); err != nil {
+		return nil, err
+	}
+	book.random = rand.New(rand.NewSource(time.Now().UnixNano()))
 
 	return book, nil
 }
 
-func (b *Book) pickMove(position *Position) Move {
-	// The generation of random numbers is too important to be left to chance.
-	// Returns pseudo-random integer in [0, limit] range. It panics if limit <= 0.
-	random := func(limit int) int {
-		rand.Seed(time.Now().Unix()); return rand.Intn(limit)
+// Opens the books in the order of priority given as a list of file names, ex.
+// "repertoire.bin:gm2001.bin" (the list separator is ';' on Windows).
+func NewBooks(bookFiles string) (books []*Book, err error) {
+	for _, fileName := range filepath.SplitList(bookFiles) {
+		if fileName = strings.TrimSpace(fileName); fileName != `` {
+			book, err := NewBook(fileName)
+			if err != nil {
+				return nil, err
+			}
+			books = append(books, book)
+		}
+	}
+
+	return books, nil
+}
+
+// Returns the engine's opening books. They are loaded once and get reloaded
+// only when the list of book files changes.
+func (e *Engine) openBooks() ([]*Book, error) {
+	if e.books == nil || e.booksFile != e.bookFile {
+		books, err := NewBooks(e.bookFile)
+		if err != nil {
+			return nil, err
+		}
+		e.books, e.booksFile = books, e.bookFile
 	}
 
-	entries := b.lookup(position)
-	switch length := len(entries); length {
-	case 0:
-		// TODO: set the "useless book" flag after a few misses.
+	return e.books, nil
+}
+
+// Sets move selection policy and the source of random numbers, ex. the one
+// shared by the engine's games so that the seed is honored across moves. The
+// weights get adjusted by learning values if learning is enabled.
+func (b *Book) with(policy BookPolicy, random *rand.Rand, learn bool) *Book {
+	b.policy, b.random, b.learn = policy, random, learn
+	return b
+}
+
+func (b *Book) pickMove(position *Position) Move {
+	entries := b.candidates(b.lookup(position))
+	if len(entries) == 0 {
 		return Move(0)
-	case 1:
-		// The only move available.
-		return b.move(position, entries[0])
-	default:
-		// Sort book entries by score and pick among two best moves.
-		sort.Sort(byBookScore{entries})
-		best := min(2, len(entries))
-		return b.move(position, entries[random(best)])
 	}
+
+	return b.move(position, entries[b.pick(entries)])
 }
 
-func (b *Book) lookup(position *Position) (entries []Entry) {
-	var entry Entry
+// Returns book entries sorted by weight, best first, leaving out the ones with
+// the weight below the policy's threshold.
+func (b *Book) candidates(entries []Entry) []Entry {
+	sort.Stable(byBookScore{entries})
+	for i, entry := range entries {
+		if entry.weight() < b.policy.minWeight {
+			return entries[:i]
+		}
+	}
 
-	file, err := os.Open(b.fileName)
-	if err != nil {
-		return entries
+	return entries
+}
+
+// Returns the index of the entry picked by the policy among the candidates.
+func (b *Book) pick(entries []Entry) int {
+	switch b.policy.kind {
+	case BookBest:
+		return 0
+	case BookWeighted:
+		total := 0
+		for _, entry := range entries {
+			total += entry.weight()
+		}
+		if total > 0 {
+			n := b.random.Intn(total)
+			for i, entry := range entries {
+				if n -= entry.weight(); n < 0 {
+					return i
+				}
+			}
+		}
+		return 0
+	}
+
+	return b.random.Intn(min(max(1, b.policy.top), len(entries)))
+}
+
+// Sets the policy kind given its name. Returns false if the name is unknown.
+func (policy *BookPolicy) set(name string) bool {
+	for kind, policyName := range bookPolicies {
+		if name == policyName {
+			policy.kind = kind
+			return true
+		}
+	}
+
+	return false
+}
+
+func (policy BookPolicy) String() string {
+	description := bookPolicies[policy.kind]
+	if policy.kind == BookUniform {
+		description += fmt.Sprintf(` among top %d`, policy.top)
+	}
+	if policy.minWeight > 0 {
+		description += fmt.Sprintf(`, min weight %d`, policy.minWeight)
+	}
+	if policy.seed != 0 {
+		description += fmt.Sprintf(`, seed %d`, policy.seed)
 	}
-	defer file.Close()
 
+	return description
+}
+
+// Returns all book entries for the position.
+func (b *Book) lookup(position *Position) (entries []Entry) {
 	key := position.id
 
 	// Since book entries are ordered by polyglot key we can use binary
 	// search to find *first* book entry that matches the position.
-	first, current, last := int64(-1), int64(0), b.entries
-	for first < last {
-		current = (first + last) / 2
-		file.Seek(current * 16, 0)
-		binary.Read(file, binary.BigEndian, &entry)
-		if key <= entry.Key {
-			last = current
-		} else {
-			first = current + 1
-		}
-	}
+	first := sort.Search(len(b.entries), func(i int) bool {
+		return b.entries[i].Key >= key
+	})
 
-	// Read all book entries for the given position.
-	file.Seek(first * 16, 0)
-	for {
-		binary.Read(file, binary.BigEndian, &entry)
-		if key != entry.Key {
-			break
-		} else {
-			entries = append(entries, entry)
+	for i := first; i < len(b.entries) && b.entries[i].Key == key; i++ {
+		entry := b.entries[i]
+		entry.Learn = 0
+		if b.learn {
+			entry.Learn = uint32(b.learning[bookMove{ entry.Key, entry.Move }])
 		}
+		entries = append(entries, entry)
 	}
 
 	return entries
@@ -107,27 +221,21 @@ func (b *Book) lookup(position *Position) (entries []Entry) {
 func (b *Book) move(p *Position, entry Entry) Move {
 	from, to := entry.from(), entry.to()
 
-	// Check if this is a castle move. In Polyglot they are represented
-	// as E1-H1, E1-A1, E8-H8, and E8-A8.
-	if from == E1 && to == H1 {
-		return NewCastle(p, from, G1)
-	} else if from == E1 && to == A1 {
-		return NewCastle(p, from, C1)
-	} else if from == E8 && to == H8 {
-		return NewCastle(p, from, G8)
-	} else if from == E8 && to == A8 {
-		return NewCastle(p, from, C8)
-	} else {
+	// Check if this is a castle move. In Polyglot they are represented as
+	// the king taking its own rook, ex. E1-H1 or E8-A8, and so are they in
+	// Donna.
+	piece := p.pieces[from]
+	if piece.isKing() && p.pieces[to] == rook(piece.color()) {
+		return NewCastle(p, from, to)
+	} else if piece.isPawn() && to > H1 && to < A8 {
 		// Special treatment for non-promo pawn moves since they might
 		// cause en-passant.
-		if piece := p.pieces[from]; piece.isPawn() && to > H1 && to < A8 {
-			return NewPawnMove(p, from, to)
-		}
+		return NewPawnMove(p, from, to)
 	}
 
 	move := NewMove(p, from, to)
 	if promo := entry.promoted(); promo != 0 {
-		move.promote(promo)
+		move = move.promote(promo)
 	}
 
 	return move
@@ -156,10 +264,33 @@ func (e *Entry) promoted() int {
 	return piece * 2 + 2
 }
 
+// Returns the entry's move in coordinate notation, ex. `e2e4` or `a7a8q`.
+func (e *Entry) notation() string {
+	from, to := e.from(), e.to()
+	notation := []byte{ byte(col(from)) + 'a', byte(row(from)) + '1', byte(col(to)) + 'a', byte(row(to)) + '1' }
+	if piece := (e.Move >> 12) & 7; piece != 0 && piece <= 4 {
+		notation = append(notation, " nbrq"[piece])
+	}
+
+	return string(notation)
+}
+
+// Encodes the move the way polyglot does; castles are the king taking its own
+// rook in both.
+func polyglotMove(move Move) uint16 {
+	from, to := move.from(), move.to()
+	encoded := uint16(row(from) << 9 | col(from) << 6 | row(to) << 3 | col(to))
+	if promo := move.promo(); promo != 0 {
+		encoded |= uint16(promo.id() - 1) << 12
+	}
+
+	return encoded
+}
+
 type byBookScore struct {
 	list []Entry
 }
 
 func (a byBookScore) Len() int           { return len(a.list) }
 func (a byBookScore) Swap(i, j int)      { a.list[i], a.list[j] = a.list[j], a.list[i] }
-func (a byBookScore) Less(i, j int) bool { return a.list[i].Score > a.list[j].Score }
+func (a byBookScore) Less(i, j int) bool { return a.list[i].weight() > a.list[j].weight() }
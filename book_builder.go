@@ -0,0 +1,218 @@
+// Copyright (c) 2014-2018 by Michael Dvorkin. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+//
+// I am making my contributions/submissions to this project solely in my
+// personal capacity and am not conveying any rights to any intellectual
+// property of any third parties.
+
+package donna
+
+import (
+	`bufio`
+	`encoding/binary`
+	`os`
+	`sort`
+	`strconv`
+	`strings`
+)
+
+// Builds polyglot opening book from PGN games. The moves made within the first
+// plies are aggregated by position hash and weighed by the game results the
+// same way polyglot does: two points for a win and one for a draw.
+type BookBuilder struct {
+	maxPly     int  			// Moves made past that ply are ignored.
+	minGames   int  			// Minimum number of games the move should be played in.
+	minRating  int  			// Minimum rating of the player making the move.
+	results    []string 		// Game results to learn from.
+	games      int  			// Number of games the book was built from.
+	moves      map[bookMove]*bookStats 	// Statistics of the moves played.
+	game       *Game 			// Scratch game to replay PGN moves.
+}
+
+// Book move made in the position with the given polyglot hash.
+type bookMove struct {
+	key   uint64
+	move  uint16
+}
+
+// How many times the book move was played, and how many points it has scored
+// for the side that made it.
+type bookStats struct {
+	games   int
+	points  int
+}
+
+// Creates book builder with the given settings, ex. `maxply`, 16, `mingames`,
+// 3. By default the first 20 plies of all decisive and drawn games are used.
+func NewBookBuilder(args ...interface{}) *BookBuilder {
+	builder := &BookBuilder{ maxPly: 20, minGames: 1, results: []string{ `1-0`, `0-1`, `1/2-1/2` } }
+	builder.moves = make(map[bookMove]*bookStats)
+	builder.game = NewEngine().NewGame()
+
+	for i := 0; i < len(args); i += 2 {
+		switch value := args[i+1]; args[i] {
+		case `maxply`:
+			builder.maxPly = min(value.(int), MaxPly)
+		case `mingames`:
+			builder.minGames = value.(int)
+		case `minrating`:
+			builder.minRating = value.(int)
+		case `results`:
+			builder.results = strings.FieldsFunc(value.(string), func(r rune) bool {
+				return r == ',' || r == ' '
+			})
+		}
+	}
+
+	return builder
+}
+
+// Adds the games from PGN text to the book. Returns the number of games used.
+func (builder *BookBuilder) Add(text string) (int, error) {
+	games, err := ParsePgn(text)
+	if err != nil {
+		return 0, err
+	}
+
+	used := 0
+	for i := range games {
+		if builder.add(&games[i]) {
+			used++
+		}
+	}
+	builder.games += used
+
+	return used, nil
+}
+
+// Replays the game up to max ply and collects the moves made by the players
+// with high enough rating. Games with unwanted result or invalid starting
+// position are skipped, and invalid move ends the game early.
+func (builder *BookBuilder) add(pgn *PgnGame) bool {
+	result := pgn.tag(`Result`)
+	if result == `` {
+		result = pgn.result
+	}
+	if !builder.wanted(result) {
+		return false
+	}
+
+	builder.game.initial = initialFen
+	if fen := pgn.tag(`FEN`); fen != `` {
+		builder.game.initial = fen
+	}
+	position, err := builder.game.setup()
+	if err != nil {
+		return false
+	}
+
+	rating := [2]int{}
+	rating[White], _ = strconv.Atoi(pgn.tag(`WhiteElo`))
+	rating[Black], _ = strconv.Atoi(pgn.tag(`BlackElo`))
+
+	for ply, san := range pgn.moves {
+		if ply >= builder.maxPly {
+			break
+		}
+		move := NewMoveFromSan(position, san)
+		if move.null() {
+			break
+		}
+
+		if rating[position.color] >= builder.minRating {
+			key := bookMove{ position.id, polyglotMove(move) }
+			stats := builder.moves[key]
+			if stats == nil {
+				stats = &bookStats{}
+				builder.moves[key] = stats
+			}
+			stats.games++
+			stats.points += builder.points(result, position.color)
+		}
+		position = builder.game.makeMove(move)
+	}
+
+	return true
+}
+
+// Returns true if the games with the given result should be used.
+func (builder *BookBuilder) wanted(result string) bool {
+	for _, wanted := range builder.results {
+		if result == wanted {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the points scored by the given side: two for a win and one for a draw.
+func (builder *BookBuilder) points(result string, color int) int {
+	switch result {
+	case `1-0`:
+		return let(color == White, 2, 0)
+	case `0-1`:
+		return let(color == Black, 2, 0)
+	case `1/2-1/2`:
+		return 1
+	}
+
+	return 0
+}
+
+// Returns book entries sorted by polyglot key, and by score within the same
+// key. The moves played in fewer than minimum number of games and the ones that
+// have never scored are left out. Scores get scaled down to fit 16 bits.
+func (builder *BookBuilder) Entries() (entries []Entry) {
+	most := 0
+	for _, stats := range builder.moves {
+		if stats.games >= builder.minGames {
+			most = max(most, stats.points)
+		}
+	}
+
+	for key, stats := range builder.moves {
+		if stats.games >= builder.minGames && stats.points > 0 {
+			score := stats.points
+			if most > 0xFFFF {
+				score = max(1, score * 0xFFFF / most)
+			}
+			entries = append(entries, Entry{ Key: key.key, Move: key.move, Score: uint16(score) })
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Key != entries[j].Key {
+			return entries[i].Key < entries[j].Key
+		}
+		if entries[i].Score != entries[j].Score {
+			return entries[i].Score > entries[j].Score
+		}
+		return entries[i].Move < entries[j].Move
+	})
+
+	return entries
+}
+
+// Writes the book to the file as 16-byte big-endian polyglot records.
+func (builder *BookBuilder) Write(fileName string) (int, error) {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	entries := builder.Entries()
+	writer := bufio.NewWriter(file)
+	for _, entry := range entries {
+		if err = binary.Write(writer, binary.BigEndian, entry); err != nil {
+			return 0, err
+		}
+	}
+	if err = writer.Flush(); err != nil {
+		return 0, err
+	}
+
+	return len(entries), file.Close()
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2014-2018 by Michael Dvorkin. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+//
+// I am making my contributions/submissions to this project solely in my
+// personal capacity and am not conveying any rights to any intellectual
+// property of any third parties.
+
+package donna
+
+import(`github.com/michaeldv/donna/expect`; `path/filepath`; `testing`)
+
+const bookGames = `
+[White "A"][Black "B"][WhiteElo "2500"][BlackElo "2100"][Result "1-0"]
+1. e4 e5 2. Nf3 Nc6 3. Bb5 1-0
+
+[White "C"][Black "D"][WhiteElo "2200"][BlackElo "2400"][Result "0-1"]
+1. e4 c5 2. Nf3 d6 0-1
+
+[White "E"][Black "F"][WhiteElo "2600"][BlackElo "2600"][Result "1/2-1/2"]
+1. d4 d5 2. c4 e6 1/2-1/2
+
+[White "G"][Black "H"][Result "*"]
+1. a4 *
+`
+
+// Returns book entries for the position, best first.
+func bookMoves(entries []Entry, p *Position) (moves []string) {
+	for _, entry := range entries {
+		if entry.Key == p.id {
+			moves = append(moves, p.san((&Book{}).move(p, entry)))
+		}
+	}
+	return moves
+}
+
+// Moves get weighed by the game results.
+func TestBookBuilder000(t *testing.T) {
+	builder := NewBookBuilder()
+	games, err := builder.Add(bookGames)
+	expect.Eq(t, err, nil)
+	expect.Eq(t, games, 3)
+
+	entries := builder.Entries()
+	p := NewGame().start()
+	expect.Eq(t, bookMoves(entries, p), []string{ `e4`, `d4` })
+	expect.Eq(t, entries[0].Key <= entries[len(entries) - 1].Key, true)
+
+	for _, entry := range entries {
+		if entry.Key == p.id {
+			expect.Eq(t, entry.Score, uint16(let(entry.Move == polyglotEntry(E2, E4).Move, 2, 1)))
+		}
+	}
+
+	// Black's winning reply to 1. e4 goes first, and losing one is left out.
+	p = p.makeMove(NewMoveFromSan(p, `e4`))
+	expect.Eq(t, bookMoves(entries, p), []string{ `c5` })
+}
+
+// Filters by ply, number of games, rating, and results.
+func TestBookBuilder010(t *testing.T) {
+	p := NewGame().start()
+
+	builder := NewBookBuilder(`maxply`, 1)
+	builder.Add(bookGames)
+	expect.Eq(t, len(builder.Entries()), 2)
+
+	builder = NewBookBuilder(`mingames`, 2)
+	builder.Add(bookGames)
+	expect.Eq(t, bookMoves(builder.Entries(), p), []string{ `e4` })
+
+	builder = NewBookBuilder(`minrating`, 2500)
+	builder.Add(bookGames)
+	expect.Eq(t, bookMoves(builder.Entries(), p), []string{ `e4`, `d4` })
+	expect.Eq(t, bookMoves(builder.Entries(), p.makeMove(NewMoveFromSan(p, `e4`))), []string(nil))
+
+	builder = NewBookBuilder(`results`, `1/2-1/2, *`)
+	games, _ := builder.Add(bookGames)
+	expect.Eq(t, games, 2)
+	expect.Eq(t, bookMoves(builder.Entries(), p), []string{ `d4` })
+}
+
+// Castles and promotions are encoded the polyglot way.
+func TestBookBuilder020(t *testing.T) {
+	p := NewGame(`Ke1,Ra1,Rh1,a7`, `Kd8`).start()
+	expect.Eq(t, polyglotMove(NewMoveFromSan(p, `O-O`)), polyglotEntry(E1, H1).Move)
+	expect.Eq(t, polyglotMove(NewMoveFromSan(p, `O-O-O`)), polyglotEntry(E1, A1).Move)
+	expect.Eq(t, polyglotMove(NewMoveFromSan(p, `a8=Q`)), polyglotEntry(A7, A8).Move | 4 << 12)
+	expect.Eq(t, polyglotMove(NewMoveFromSan(p, `a8=N`)), polyglotEntry(A7, A8).Move | 1 << 12)
+}
+
+// Written book can be read back.
+func TestBookBuilder030(t *testing.T) {
+	builder := NewBookBuilder()
+	builder.Add(bookGames)
+	fileName := filepath.Join(t.TempDir(), `book.bin`)
+	entries, err := builder.Write(fileName)
+	expect.Eq(t, err, nil)
+	expect.Eq(t, entries, 9)
+
+	book, err := NewBook(fileName)
+	expect.Eq(t, err, nil)
+	expect.Eq(t, len(book.entries), 9)
+
+	p := NewGame().start()
+	expect.Eq(t, len(book.lookup(p)), 2)
+	expect.Contain(t, p.san(book.pickMove(p)), `4`)
+
+	p = p.makeMove(NewMoveFromSan(p, `d4`))
+	expect.Eq(t, p.san(book.pickMove(p)), `d5`)
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2014-2018 by Michael Dvorkin. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+//
+// I am making my contributions/submissions to this project solely in my
+// personal capacity and am not conveying any rights to any intellectual
+// property of any third parties.
+
+package donna
+
+import (
+	`bytes`
+	`fmt`
+	`sort`
+	`strings`
+)
+
+// Book lines are not followed past that many plies.
+const bookTreeLimit = 256
+
+// Book statistics: all the positions and moves, and what can be reached from
+// the initial position by playing legal book moves.
+type BookStats struct {
+	Positions  int 	// Number of distinct positions.
+	Moves      int 	// Number of book entries.
+	Reachable  int 	// Positions reachable from the initial position.
+	MaxDepth   int 	// Longest line from the initial position, in plies.
+	Orphans    int 	// Entries with moves that are illegal in reachable positions.
+}
+
+// Book entry for the position along with its move, or zero move if the entry
+// is an orphan, i.e. its move is illegal in the position.
+type bookChoice struct {
+	Entry
+	move  Move
+}
+
+// Returns book entries for the position sorted by weight, best first, and the
+// total weight of the entries.
+func (b *Book) choices(p *Position) (choices []bookChoice, total int) {
+	entries := b.lookup(p)
+	sort.Stable(byBookScore{entries})
+
+	valid := p.validMoves()
+	for _, entry := range entries {
+		choice := bookChoice{ Entry: entry }
+		if move := b.move(p, entry); move.some() {
+			for _, legal := range valid {
+				if move == legal {
+					choice.move = move
+					break
+				}
+			}
+		}
+		choices, total = append(choices, choice), total + entry.weight()
+	}
+
+	return choices, total
+}
+
+// Returns book entries for the position with their moves in SAN, weights, and
+// the odds of being picked by weighted policy. Orphan entries are shown in
+// coordinate notation.
+func (b *Book) List(p *Position) string {
+	var buffer bytes.Buffer
+
+	choices, total := b.choices(p)
+	if len(choices) == 0 {
+		return "No book moves\n"
+	}
+
+	buffer.WriteString("Move     Weight  Percent   Learn\n")
+	for _, choice := range choices {
+		move := choice.notation() + `?`
+		if choice.move.some() {
+			move = p.san(choice.move)
+		}
+		percent := 0.0
+		if total > 0 {
+			percent = float64(choice.weight()) * 100.0 / float64(total)
+		}
+		fmt.Fprintf(&buffer, "%-8s %6d %7.1f%% %7d", move, choice.weight(), percent, int32(choice.Learn))
+		if choice.move.null() {
+			buffer.WriteString(`  illegal`)
+		}
+		buffer.WriteByte('\n')
+	}
+
+	return buffer.String()
+}
+
+// Returns book lines starting in the position up to the given depth as a tree
+// with one move per line indented by ply.
+func (b *Book) Tree(p *Position, depth int) string {
+	var buffer bytes.Buffer
+
+	b.tree(&buffer, p, min(depth, bookTreeLimit), 0)
+	return buffer.String()
+}
+
+func (b *Book) tree(buffer *bytes.Buffer, p *Position, depth, ply int) {
+	if depth <= 0 {
+		return
+	}
+
+	choices, total := b.choices(p)
+	for _, choice := range choices {
+		if choice.move.null() {
+			continue
+		}
+		number := fmt.Sprintf(`%d.`, p.fullmove)
+		if p.color == Black {
+			number += `..`
+		}
+		fmt.Fprintf(buffer, "%s%s %s (%d, %.1f%%)\n", strings.Repeat(`  `, ply), number, p.san(choice.move),
+			choice.weight(), float64(choice.weight()) * 100.0 / float64(max(1, total)))
+
+		position := p.makeMove(choice.move)
+		b.tree(buffer, position, depth - 1, ply + 1)
+		position.undoLastMove()
+	}
+}
+
+// Returns book lines starting in the position up to the given depth as a PGN
+// game: the heaviest book move continues the line while the others make the
+// variations.
+func (b *Book) Pgn(p *Position, depth int) string {
+	var buffer bytes.Buffer
+
+	fmt.Fprintf(&buffer, "[Event \"%s\"]\n", pgnEscape(b.fileName))
+	for _, name := range pgnRoster[1:6] {
+		fmt.Fprintf(&buffer, "[%s \"?\"]\n", name)
+	}
+	buffer.WriteString("[Result \"*\"]\n")
+	if fen := p.fen(); fen != initialFen {
+		fmt.Fprintf(&buffer, "[SetUp \"1\"]\n[FEN \"%s\"]\n", fen)
+	}
+	buffer.WriteByte('\n')
+
+	tokens := b.pgn(nil, p, min(depth, bookTreeLimit), true)
+	pgnWrap(&buffer, append(tokens, `*`))
+	buffer.WriteString("\n\n")
+
+	return buffer.String()
+}
+
+// Appends movetext tokens of the book lines starting in the position. Black's
+// move needs its number when it starts the line or follows a variation.
+func (b *Book) pgn(tokens []string, p *Position, depth int, number bool) []string {
+	if depth <= 0 {
+		return tokens
+	}
+
+	var moves []Move
+	choices, _ := b.choices(p)
+	for _, choice := range choices {
+		if choice.move.some() {
+			moves = append(moves, choice.move)
+		}
+	}
+	if len(moves) == 0 {
+		return tokens
+	}
+
+	// Returns move number and the move itself.
+	move := func(move Move, number bool) []string {
+		if p.color == White {
+			return []string{ fmt.Sprintf(`%d.`, p.fullmove), p.san(move) }
+		} else if number {
+			return []string{ fmt.Sprintf(`%d...`, p.fullmove), p.san(move) }
+		}
+		return []string{ p.san(move) }
+	}
+
+	tokens = append(tokens, move(moves[0], number)...)
+	for _, alternative := range moves[1:] {
+		variation := move(alternative, true)
+		variation[0] = `(` + variation[0]
+		position := p.makeMove(alternative)
+		variation = b.pgn(variation, position, depth - 1, false)
+		position.undoLastMove()
+		variation[len(variation) - 1] += `)`
+		tokens = append(tokens, variation...)
+	}
+
+	position := p.makeMove(moves[0])
+	tokens = b.pgn(tokens, position, depth - 1, len(moves) > 1)
+	position.undoLastMove()
+
+	return tokens
+}
+
+// Collects book statistics walking the book lines from the position.
+func (b *Book) Stats(p *Position) (stats BookStats) {
+	for i := 0; i < len(b.entries); i++ {
+		if i == 0 || b.entries[i].Key != b.entries[i-1].Key {
+			stats.Positions++
+		}
+	}
+	stats.Moves = len(b.entries)
+
+	depths, visiting := make(map[uint64]int), make(map[uint64]bool)
+	stats.MaxDepth = b.stats(p, &stats, depths, visiting, 0)
+
+	return stats
+}
+
+// Returns the length of the longest book line starting in the position. The
+// lengths are remembered by position so that transpositions are walked only
+// once, and the lines that repeat positions are cut short.
+func (b *Book) stats(p *Position, stats *BookStats, depths map[uint64]int, visiting map[uint64]bool, ply int) int {
+	if depth, ok := depths[p.id]; ok {
+		return depth
+	}
+	if visiting[p.id] || ply >= bookTreeLimit {
+		return 0
+	}
+
+	choices, _ := b.choices(p)
+	if len(choices) > 0 {
+		stats.Reachable++
+	}
+
+	longest := 0
+	visiting[p.id] = true
+	for _, choice := range choices {
+		if choice.move.null() {
+			stats.Orphans++
+			continue
+		}
+		position := p.makeMove(choice.move)
+		longest = max(longest, 1 + b.stats(position, stats, depths, visiting, ply + 1))
+		position.undoLastMove()
+	}
+	delete(visiting, p.id)
+	depths[p.id] = longest
+
+	return longest
+}
+
+func (stats BookStats) String() string {
+	return fmt.Sprintf("Positions: %d\n    Moves: %d\nReachable: %d\nMax depth: %d\n  Orphans: %d\n",
+		stats.Positions, stats.Moves, stats.Reachable, stats.MaxDepth, stats.Orphans)
+}
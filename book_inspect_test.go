@@ -0,0 +1,68 @@
+// Copyright (c) 2014-2018 by Michael Dvorkin. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+//
+// I am making my contributions/submissions to this project solely in my
+// personal capacity and am not conveying any rights to any intellectual
+// property of any third parties.
+
+package donna
+
+import(`github.com/michaeldv/donna/expect`; `sort`; `testing`)
+
+// Returns the book built from test games with an orphan entry for 1. e2-e5.
+func inspectBook(t *testing.T) *Book {
+	builder := NewBookBuilder()
+	builder.Add(bookGames)
+	entries := append(builder.Entries(), Entry{ Key: NewGame().start().id, Move: polyglotEntry(E2, E5).Move, Score: 1 })
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	book, err := NewBook(writeBook(t, entries))
+	expect.Eq(t, err, nil)
+
+	return book
+}
+
+// Book moves for the position.
+func TestBookInspect000(t *testing.T) {
+	book, p := inspectBook(t), NewGame().start()
+	expect.Eq(t, book.List(p), "Move     Weight  Percent   Learn\n" +
+		"e4            2    50.0%       0\n" +
+		"d4            1    25.0%       0\n" +
+		"e2e5?         1    25.0%       0  illegal\n")
+
+	p = NewGame(`8/8/8/8/8/8/8/8 w - - 0 1`).start()
+	expect.Eq(t, book.List(p), "No book moves\n")
+}
+
+// Promotions are made the polyglot way.
+func TestBookInspect010(t *testing.T) {
+	p := NewGame(`Ke1,a7`, `Kh8`).start()
+	book := &Book{ entries: []Entry{ { Key: p.id, Move: polyglotEntry(A7, A8).Move | 4 << 12, Score: 1 } } }
+	choices, total := book.choices(p)
+	expect.Eq(t, total, 1)
+	expect.Eq(t, p.san(choices[0].move), `a8=Q+`)
+	expect.Eq(t, choices[0].notation(), `a7a8q`)
+}
+
+// Book lines as a tree and PGN.
+func TestBookInspect020(t *testing.T) {
+	book, p := inspectBook(t), NewGame().start()
+	expect.Eq(t, book.Tree(p, 2), "1. e4 (2, 50.0%)\n" +
+		"  1... c5 (2, 100.0%)\n" +
+		"1. d4 (1, 25.0%)\n" +
+		"  1... d5 (1, 100.0%)\n")
+
+	pgn := book.Pgn(p, 4)
+	expect.Contain(t, pgn, "[Result \"*\"]\n\n1. e4 (1. d4 d5 2. c4 e6) 1... c5 *\n")
+	expect.NotContain(t, pgn, `FEN`)
+
+	game, err := NewEngine().NewGameFromPgn(pgn, 1)
+	expect.Eq(t, err, nil)
+	expect.Eq(t, len(game.moves), 2)
+}
+
+// Book statistics.
+func TestBookInspect030(t *testing.T) {
+	book, p := inspectBook(t), NewGame().start()
+	expect.Eq(t, book.Stats(p), BookStats{ Positions: 8, Moves: 10, Reachable: 5, MaxDepth: 4, Orphans: 1 })
+}
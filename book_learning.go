@@ -0,0 +1,200 @@
+// Copyright (c) 2014-2018 by Michael Dvorkin. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+//
+// I am making my contributions/submissions to this project solely in my
+// personal capacity and am not conveying any rights to any intellectual
+// property of any third parties.
+
+package donna
+
+import (
+	`bufio`
+	`encoding/binary`
+	`fmt`
+	`io`
+	`os`
+	`sort`
+)
+
+// Book learning values stay within [-bookLearnLimit, bookLearnLimit] range. The
+// weight of the book move gets scaled by (limit + learn) / limit so that losing
+// lines fade away while winning ones get up to twice as likely to be picked.
+const bookLearnLimit = 100
+
+// Learning value adjustments: the outcome of the game and the search score
+// right after leaving the book, one point per 10 centipawns.
+const (
+	bookLearnWin   = 20
+	bookLearnLoss  = -20
+	bookLearnScore = 20 	// Score adjustment limit.
+)
+
+// The book is no longer probed after that many misses in a row.
+const bookMissLimit = 3
+
+// Learning values of the book moves. They are kept in a sidecar file next to
+// the book, ex. gm2001.bin.learn, using the same 16-byte polyglot records with
+// the Learn field holding the value. The book itself is never written to.
+type BookLearning map[bookMove]int32
+
+// Book move played by the engine, the side that played it, and the book it
+// came from.
+type bookPlayed struct {
+	bookMove
+	color  int
+	book   *Book
+}
+
+// Returns the name of learning file for the book.
+func learningFile(bookFile string) string {
+	return bookFile + `.learn`
+}
+
+// Reads learning values from the file. Missing file means nothing has been
+// learned yet.
+func LoadBookLearning(fileName string) (BookLearning, error) {
+	learning := make(BookLearning)
+
+	file, err := os.Open(fileName)
+	if os.IsNotExist(err) {
+		return learning, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		var entry Entry
+		if err = binary.Read(reader, binary.BigEndian, &entry); err == io.EOF {
+			return learning, nil
+		} else if err != nil {
+			return nil, err
+		}
+		learning[bookMove{ entry.Key, entry.Move }] = int32(entry.Learn)
+	}
+}
+
+// Writes learning values to the file sorted by polyglot key.
+func (learning BookLearning) Save(fileName string) error {
+	entries := make([]Entry, 0, len(learning))
+	for key, learn := range learning {
+		entries = append(entries, Entry{ Key: key.key, Move: key.move, Learn: uint32(learn) })
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key || (entries[i].Key == entries[j].Key && entries[i].Move < entries[j].Move)
+	})
+
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	for _, entry := range entries {
+		if err = binary.Write(writer, binary.BigEndian, entry); err != nil {
+			return err
+		}
+	}
+	if err = writer.Flush(); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+// Adjusts learning value of the book move keeping it within the limits.
+func (learning BookLearning) adjust(key bookMove, delta int) BookLearning {
+	learning[key] = int32(max(-bookLearnLimit, min(bookLearnLimit, int(learning[key]) + delta)))
+	return learning
+}
+
+// Returns book entry's weight adjusted by what has been learned about the move.
+func (e *Entry) weight() int {
+	return int(e.Score) * (bookLearnLimit + int(int32(e.Learn))) / bookLearnLimit
+}
+
+// Returns book move for the position, if any, and remembers it so that the
+// engine could learn from it later. The books are searched in the order of
+// priority. They are not probed past the book depth, or once the game has
+// been out of the books for a few moves in a row.
+func (game *Game) bookMove(position *Position) Move {
+	engine := game.engine
+	if !engine.ownBook || len(engine.bookFile) == 0 || len(engine.options.searchMoves) != 0 || game.bookMisses >= bookMissLimit {
+		return Move(0)
+	}
+	if ply := (position.fullmove - 1) * 2 + position.color; engine.bookDepth > 0 && ply >= engine.bookDepth {
+		return Move(0)
+	}
+
+	books, err := engine.openBooks()
+	if err != nil {
+		if !engine.uci && !engine.cecp && !game.quiet {
+			fmt.Printf("Book error: %v\n", err)
+		}
+		return Move(0)
+	}
+
+	for _, book := range books {
+		if move := book.with(engine.bookPolicy, engine.bookRandom, engine.bookLearning).pickMove(position); move != 0 {
+			game.bookMisses = 0
+			game.bookLine = append(game.bookLine, bookPlayed{ bookMove{ position.id, polyglotMove(move) }, position.color, book })
+			return move
+		}
+	}
+	game.bookMisses++
+
+	return Move(0)
+}
+
+// Learns from the search score of the first position out of the book: the book
+// moves that have led to good positions get preferred. Mates, which come with
+// zero score, get the biggest adjustment.
+func (game *Game) learnScore(color int, result Result) {
+	if game.bookScored || len(game.bookLine) == 0 {
+		return
+	}
+	game.bookScored = true
+
+	delta := max(-bookLearnScore, min(bookLearnScore, result.Score / 10))
+	if result.Mate != 0 {
+		delta = let(result.Mate > 0, bookLearnScore, -bookLearnScore)
+	}
+	game.learnBook(func(played bookPlayed) int {
+		return let(played.color == color, delta, -delta)
+	})
+}
+
+// Learns from the game result, ex. `1-0`, once the game is over. Book moves of
+// the winning side get promoted and the ones of the losing side get demoted.
+func (game *Game) learnOutcome(result string) {
+	winner := map[string]int{ `1-0`: White, `0-1`: Black }
+	if color, ok := winner[result]; ok && len(game.bookLine) > 0 {
+		game.learnBook(func(played bookPlayed) int {
+			return let(played.color == color, bookLearnWin, bookLearnLoss)
+		})
+	}
+	game.bookLine = nil // Learn from the game only once.
+}
+
+// Adjusts learning values of the book moves played in the game and saves them.
+func (game *Game) learnBook(delta func(bookPlayed) int) {
+	engine := game.engine
+	if !engine.bookLearning {
+		return
+	}
+
+	books := make(map[*Book]bool)
+	for _, played := range game.bookLine {
+		played.book.learning.adjust(played.bookMove, delta(played))
+		books[played.book] = true
+	}
+
+	for book := range books {
+		if err := book.learning.Save(learningFile(book.fileName)); err != nil && !engine.uci && !engine.cecp && !game.quiet {
+			fmt.Printf("Book learning error: %v\n", err)
+		}
+	}
+}
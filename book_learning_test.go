@@ -0,0 +1,111 @@
+// Copyright (c) 2014-2018 by Michael Dvorkin. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+//
+// I am making my contributions/submissions to this project solely in my
+// personal capacity and am not conveying any rights to any intellectual
+// property of any third parties.
+
+package donna
+
+import(`github.com/michaeldv/donna/expect`; `path/filepath`; `testing`)
+
+// Writes the book with 1. e4 and 1. d4 entries, and returns its file name.
+func learningBook(t *testing.T) string {
+	id := NewGame().start().id
+	return writeBook(t, []Entry{
+		{ Key: id, Move: polyglotEntry(E2, E4).Move, Score: 100 },
+		{ Key: id, Move: polyglotEntry(D2, D4).Move, Score: 70 },
+	})
+}
+
+// Learning scales book move weights.
+func TestBookLearning000(t *testing.T) {
+	expect.Eq(t, (&Entry{ Score: 100 }).weight(), 100)
+	expect.Eq(t, (&Entry{ Score: 100, Learn: uint32(0xFFFFFFCE) }).weight(), 50)
+	expect.Eq(t, (&Entry{ Score: 100, Learn: 100 }).weight(), 200)
+
+	learning := make(BookLearning)
+	key := bookMove{ 42, 1 }
+	learning.adjust(key, -70).adjust(key, -70)
+	expect.Eq(t, learning[key], int32(-bookLearnLimit))
+	learning.adjust(key, 250)
+	expect.Eq(t, learning[key], int32(bookLearnLimit))
+}
+
+// Learning values are saved to and loaded from the sidecar file.
+func TestBookLearning010(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), `book.bin.learn`)
+	learning, err := LoadBookLearning(fileName)
+	expect.Eq(t, err, nil)
+	expect.Eq(t, len(learning), 0)
+
+	learning[bookMove{ 2, 1 }], learning[bookMove{ 1, 2 }] = -15, 30
+	expect.Eq(t, learning.Save(fileName), nil)
+
+	loaded, err := LoadBookLearning(fileName)
+	expect.Eq(t, err, nil)
+	expect.Eq(t, loaded, learning)
+}
+
+// Lost games and bad positions out of the book demote the book move.
+func TestBookLearning020(t *testing.T) {
+	engine := NewEngine(`bookfile`, learningBook(t))
+	engine.bookPolicy.kind, engine.bookLearning = BookBest, true
+
+	game := engine.NewGame()
+	position := game.start()
+	expect.Eq(t, game.bookMove(position), NewMoveFromSan(position, `e4`))
+	game.learnScore(White, Result{ Score: -500 })
+	game.learnScore(White, Result{ Score: -500 }) // Only the first search counts.
+	game.learnOutcome(`0-1`)
+
+	learning, _ := LoadBookLearning(learningFile(engine.bookFile))
+	expect.Eq(t, learning[bookMove{ position.id, polyglotEntry(E2, E4).Move }], int32(bookLearnLoss - bookLearnScore))
+
+	game = engine.NewGame()
+	position = game.start()
+	expect.Eq(t, game.bookMove(position), NewMoveFromSan(position, `d4`))
+
+	// Without learning the book is used as is.
+	engine.bookLearning = false
+	expect.Eq(t, game.bookMove(position), NewMoveFromSan(position, `e4`))
+}
+
+// Getting mated out of the book is as bad as it gets, even though the score of
+// the mate is zero.
+func TestBookLearning025(t *testing.T) {
+	engine := NewEngine(`bookfile`, learningBook(t))
+	engine.bookPolicy.kind, engine.bookLearning = BookBest, true
+
+	game := engine.NewGame()
+	position := game.start()
+	expect.Eq(t, game.bookMove(position), NewMoveFromSan(position, `e4`))
+	game.learnScore(White, Result{ Mate: -3 })
+
+	learning, _ := LoadBookLearning(learningFile(engine.bookFile))
+	expect.Eq(t, learning[bookMove{ position.id, polyglotEntry(E2, E4).Move }], int32(-bookLearnScore))
+
+	game = engine.NewGame()
+	position = game.start()
+	expect.Eq(t, game.bookMove(position), NewMoveFromSan(position, `e4`))
+	game.learnScore(Black, Result{ Mate: 2 }) // White's book move is demoted again.
+
+	learning, _ = LoadBookLearning(learningFile(engine.bookFile))
+	expect.Eq(t, learning[bookMove{ position.id, polyglotEntry(E2, E4).Move }], int32(-2 * bookLearnScore))
+}
+
+// The book is no longer probed after a few misses in a row.
+func TestBookLearning030(t *testing.T) {
+	engine := NewEngine(`bookfile`, learningBook(t))
+	game := engine.NewGame()
+	position := game.start()
+	for i := 0; i < bookMissLimit; i++ {
+		expect.Eq(t, game.bookMove(position.makeMove(NewMoveFromSan(position, `a3`))), Move(0))
+		position.undoLastMove()
+	}
+	expect.Eq(t, game.bookMove(position), Move(0))
+
+	game = engine.NewGame()
+	expect.Ne(t, game.bookMove(game.start()), Move(0))
+}
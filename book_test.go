@@ -8,7 +8,7 @@
 
 package donna
 
-import(`github.com/michaeldv/donna/expect`; `testing`)
+import(`github.com/michaeldv/donna/expect`; `encoding/binary`; `math/rand`; `os`; `path/filepath`; `testing`)
 
 func openBook() (*Book, *Position) {
 	return &Book{}, NewGame().start()
@@ -19,6 +19,16 @@ func polyglotEntry(source, target int) Entry {
 		uint16(row(target)<<3) | uint16(col(target))}
 }
 
+// Writes book entries to temporary file and returns its name.
+func writeBook(t *testing.T, entries []Entry) string {
+	file, err := os.CreateTemp(t.TempDir(), `*.bin`)
+	expect.Eq(t, err, nil)
+	defer file.Close()
+
+	binary.Write(file, binary.BigEndian, entries)
+	return filepath.Clean(file.Name())
+}
+
 // See test key values at http://hardy.uhasselt.be/Toga/book_format.html
 func TestBook000(t *testing.T) {
 	p := NewGame().start()
@@ -164,3 +174,99 @@ func TestBook110(t *testing.T) { // 1. d4 d5
 	expect.Eq(t, p.enpassant, 0)
 	expect.Eq(t, p.castles, uint8(0x0F))
 }
+
+// Book move selection policies.
+func TestBook200(t *testing.T) {
+	entries := []Entry{ { Score: 1 }, { Score: 30 }, { Score: 0 }, { Score: 60 }, { Score: 9 } }
+	book := (&Book{}).with(BookPolicy{ kind: BookBest, minWeight: 5 }, rand.New(rand.NewSource(1)), false)
+
+	candidates := book.candidates(entries)
+	expect.Eq(t, candidates, []Entry{ { Score: 60 }, { Score: 30 }, { Score: 9 } })
+	expect.Eq(t, book.pick(candidates), 0)
+
+	book.policy = BookPolicy{ kind: BookUniform, top: 2 }
+	picked := map[int]int{}
+	for i := 0; i < 1000; i++ {
+		picked[book.pick(candidates)]++
+	}
+	expect.Eq(t, len(picked), 2)
+	expect.Eq(t, picked[2], 0)
+
+	book.policy = BookPolicy{ kind: BookWeighted }
+	picked = map[int]int{}
+	for i := 0; i < 9900; i++ {
+		picked[book.pick(candidates)]++
+	}
+	expect.True(t, picked[0] > 5500 && picked[0] < 6500)
+	expect.True(t, picked[1] > 2500 && picked[1] < 3500)
+	expect.True(t, picked[2] > 600 && picked[2] < 1200)
+}
+
+// The same seed gives the same picks.
+func TestBook210(t *testing.T) {
+	entries := []Entry{ { Score: 10 }, { Score: 20 }, { Score: 30 } }
+	policy := BookPolicy{ kind: BookWeighted }
+	engine, other := NewEngine().seedBook(42), NewEngine().seedBook(42)
+	book := (&Book{}).with(policy, engine.bookRandom, false)
+	otherBook := (&Book{}).with(policy, other.bookRandom, false)
+	for i := 0; i < 100; i++ {
+		expect.Eq(t, book.pick(entries), otherBook.pick(entries))
+	}
+
+	expect.True(t, policy.set(`best`))
+	expect.Eq(t, policy.kind, BookBest)
+	expect.False(t, policy.set(`worst`))
+	expect.Eq(t, defaultBookPolicy.String(), `uniform among top 2`)
+}
+
+// Books are loaded into memory and searched in the order of priority.
+func TestBook300(t *testing.T) {
+	p := NewGame().start()
+	e4 := p.makeMove(NewMoveFromSan(p, `e4`))
+	primary := writeBook(t, []Entry{ { Key: e4.id, Move: polyglotEntry(C7, C5).Move, Score: 1 } })
+	e4.undoLastMove()
+	general := learningBook(t)
+
+	books, err := NewBooks(primary + string(os.PathListSeparator) + general)
+	expect.Eq(t, err, nil)
+	expect.Eq(t, len(books), 2)
+	expect.Eq(t, len(books[1].entries), 2)
+	expect.Eq(t, len(books[1].lookup(p)), 2)
+	expect.Eq(t, len(books[0].lookup(p)), 0)
+
+	engine := NewEngine(`bookfile`, primary + string(os.PathListSeparator) + general)
+	engine.bookPolicy.kind = BookBest
+	game := engine.NewGame()
+	position := game.start()
+	expect.Eq(t, game.bookMove(position), NewMoveFromSan(position, `e4`))
+	position = game.makeMove(NewMoveFromSan(position, `e4`))
+	expect.Eq(t, game.bookMove(position), NewMoveFromSan(position, `c5`))
+	expect.Eq(t, game.bookLine[0].book, engine.books[1])
+	expect.Eq(t, game.bookLine[1].book, engine.books[0])
+
+	// The books are loaded once.
+	books = engine.books
+	game.bookMove(position)
+	expect.Eq(t, engine.books, books)
+
+	_, err = NewBooks(general + string(os.PathListSeparator) + `nonexistent.bin`)
+	expect.Ne(t, err, nil)
+}
+
+// Book is not used past the book depth.
+func TestBook310(t *testing.T) {
+	engine := NewEngine(`bookfile`, learningBook(t))
+	game := engine.NewGame()
+	position := game.start()
+
+	engine.bookDepth = 1
+	expect.Ne(t, game.bookMove(position), Move(0))
+	position = game.makeMove(NewMoveFromSan(position, `e4`))
+	expect.Eq(t, game.bookMove(position), Move(0))
+	expect.Eq(t, game.bookMisses, 0)
+
+	position = NewGame(`rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 2`).start()
+	expect.Eq(t, game.bookMove(position), Move(0))
+	engine.bookDepth = 0
+	expect.Ne(t, game.bookMove(position), Move(0))
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2014-2018 by Michael Dvorkin. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+//
+// I am making my contributions/submissions to this project solely in my
+// personal capacity and am not conveying any rights to any intellectual
+// property of any third parties.
+
+package donna
+
+import `strings`
+
+// Castle sides used to index castle tables.
+const (
+	Kingside = iota
+	Queenside
+)
+
+// Castle setup of the game: home squares of the kings and castling rooks along
+// with the masks derived from them. In regular chess the kings start on E1/E8
+// and the rooks in the corners; in Chess960 they could be anywhere on the back
+// rank as long as the king stays between the rooks. Either way the castle is
+// encoded as the king taking its own rook, and the pieces end up on the same
+// squares: the king on G or C file and the rook on F or D file.
+type Castling struct {
+	chess960  bool           // True unless kings and castling rooks are on regular squares.
+	king      [2]int         // King's home square for both colors.
+	rook      [2][2]int      // Castling rooks' home squares, [color][Kingside/Queenside].
+	rights    [64]uint8      // Castle rights that remain after a move from or to the square.
+	gap       [2][2]Bitmask  // Squares that should be *empty* in order for the castle to be valid.
+	safe      [2][2]Bitmask  // Squares that should be *safe* in order for the castle to be valid.
+}
+
+// Castle rights bits for each color and side.
+var castleFlag = [2][2]uint8{ { 1, 2 }, { 4, 8 } }
+
+// Where the king and the rook end up after the castle.
+var castleKingTarget = [2][2]int{ { G1, C1 }, { G8, C8 } }
+var castleRookTarget = [2][2]int{ { F1, D1 }, { F8, D8 } }
+
+// Regular chess castle setup.
+var standardCastling = NewCastling([2]int{ E1, E8 }, [2][2]int{ { H1, A1 }, { H8, A8 } })
+
+// Chess960 knight placements on the five squares left after the bishops and
+// the queen are placed, indexed by Scharnagl's knight code.
+var chess960Knights = [10][2]int{
+	{ 0, 1 }, { 0, 2 }, { 0, 3 }, { 0, 4 }, { 1, 2 },
+	{ 1, 3 }, { 1, 4 }, { 2, 3 }, { 2, 4 }, { 3, 4 },
+}
+
+// Sets up castle tables for the given home squares of the kings and rooks.
+func NewCastling(king [2]int, rook [2][2]int) (castling Castling) {
+	castling.king, castling.rook = king, rook
+	for square := range castling.rights {
+		castling.rights[square] = 0x0F
+	}
+
+	// Returns squares between the two squares on the same rank, inclusive.
+	span := func(from, to int) (bitmask Bitmask) {
+		for square := min(from, to); square <= max(from, to); square++ {
+			bitmask.set(square)
+		}
+		return bitmask
+	}
+
+	for color := White; color <= Black; color++ {
+		castling.rights[king[color]] &= ^(castleFlag[color][Kingside] | castleFlag[color][Queenside])
+		for side := Kingside; side <= Queenside; side++ {
+			home, target := rook[color][side], castleKingTarget[color][side]
+			castling.rights[home] &= ^castleFlag[color][side]
+
+			// Both the king and the rook should have free passage, and the
+			// king should not pass through or land on attacked square.
+			path := span(king[color], target) | span(home, castleRookTarget[color][side])
+			castling.gap[color][side] = path & ^bit[king[color]] & ^bit[home]
+			castling.safe[color][side] = span(king[color], target)
+
+			castling.chess960 = castling.chess960 || col(home) != let(side == Kingside, 7, 0)
+		}
+		castling.chess960 = castling.chess960 || king[color] != homeKing[color]
+	}
+
+	return castling
+}
+
+// Returns castle side for the king's move to the given square: the square is
+// either castling rook's home or the king's castle destination on G or C file.
+func (castling *Castling) side(color, from, to int) int {
+	if to == castling.rook[color][Kingside] {
+		return Kingside
+	} else if to == castling.rook[color][Queenside] {
+		return Queenside
+	}
+
+	switch col(to) {
+	case 6:
+		return Kingside
+	case 2:
+		return Queenside
+	}
+
+	return let(col(to) > col(from), Kingside, Queenside)
+}
+
+// Returns FEN string of the Chess960 starting position with the given number
+// (0 to 959) as defined by Reinhard Scharnagl. Position 518 is the regular
+// chess starting position.
+func chess960Fen(n int) string {
+	var rank [8]byte
+
+	// Places the piece on the i-th empty square.
+	place := func(piece byte, i int) {
+		for col := range rank {
+			if rank[col] == 0 {
+				if i == 0 {
+					rank[col] = piece
+					return
+				}
+				i--
+			}
+		}
+	}
+
+	n = ((n % 960) + 960) % 960
+	rank[(n % 4) * 2 + 1] = 'b'; n /= 4 // Light-squared bishop on b, d, f, or h file.
+	rank[(n % 4) * 2] = 'b'; n /= 4     // Dark-squared bishop on a, c, e, or g file.
+	place('q', n % 6); n /= 6
+	knights := chess960Knights[n]
+	place('n', knights[1]) // Second knight goes first so that the index of the first one still holds.
+	place('n', knights[0])
+	place('r', 0); place('k', 0); place('r', 0)
+
+	black := string(rank[:])
+	return black + `/pppppppp/8/8/8/8/PPPPPPPP/` + strings.ToUpper(black) + ` w KQkq - 0 1`
+}
+
+// Returns castle setup of the game the position belongs to.
+func (p *Position) castling() *Castling {
+	return &p.thread.game.castling
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2014-2018 by Michael Dvorkin. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+//
+// I am making my contributions/submissions to this project solely in my
+// personal capacity and am not conveying any rights to any intellectual
+// property of any third parties.
+
+package donna
+
+import(`github.com/michaeldv/donna/expect`; `testing`)
+
+// Chess960 starting positions.
+func TestCastle000(t *testing.T) {
+	expect.Eq(t, chess960Fen(518), initialFen)
+	expect.Eq(t, chess960Fen(0), `bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w KQkq - 0 1`)
+	expect.Eq(t, chess960Fen(959), `rkrnnqbb/pppppppp/8/8/8/8/PPPPPPPP/RKRNNQBB w KQkq - 0 1`)
+
+	game := NewGame(chess960Fen(0))
+	p := game.start()
+	expect.True(t, game.castling.chess960)
+	expect.Eq(t, game.castling.king, [2]int{ G1, G8 })
+	expect.Eq(t, game.castling.rook, [2][2]int{ { H1, F1 }, { H8, F8 } })
+	expect.Eq(t, p.Perft(1), int64(20))
+
+	game = NewGame()
+	game.start()
+	expect.False(t, game.castling.chess960)
+}
+
+// Shredder-FEN and X-FEN castle rights.
+func TestCastle010(t *testing.T) {
+	game := NewGame(`bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9`)
+	p, err := game.setup()
+	expect.Eq(t, err, nil)
+	expect.Eq(t, game.castling.rook, [2][2]int{ { H1, F1 }, { H8, F8 } })
+	expect.Eq(t, p.fen(), `bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w KQkq - 2 9`)
+
+	// Inner castling rook is given by its file.
+	for _, rights := range []string{ `KC`, `HC` } {
+		game = NewGame(`4k3/8/8/8/8/8/8/R1R1K2R w ` + rights + ` - 0 1`)
+		p, err = game.setup()
+		expect.Eq(t, err, nil)
+		expect.Eq(t, game.castling.rook[White], [2]int{ H1, C1 })
+		expect.Eq(t, p.fen(), `4k3/8/8/8/8/8/8/R1R1K2R w KC - 0 1`)
+	}
+
+	_, err = NewGame(`4k3/8/8/8/8/8/8/R1R1K2R w B - 0 1`).setup()
+	expect.Eq(t, err.Error(), `impossible queenside castle rights for white`)
+}
+
+// Chess960 castles as the king taking its own rook.
+func TestCastle020(t *testing.T) {
+	p := NewGame(`1r2k1r1/8/8/8/8/8/8/1R2K1R1 w KQkq - 0 1`).start()
+	kingside, queenside := NewCastle(p, E1, G1), NewCastle(p, E1, B1)
+	expect.Eq(t, kingside.to(), G1)
+	expect.Eq(t, NewCastle(p, E1, C1), queenside)
+	expect.Eq(t, kingside.notation(), `e1g1`)
+	expect.Eq(t, kingside.notation960(), `e1g1`)
+	expect.Eq(t, queenside.notation(), `e1c1`)
+	expect.Eq(t, queenside.notation960(), `e1b1`)
+	expect.Eq(t, NewMoveFromNotation(p, `e1b1`), queenside)
+	expect.Eq(t, NewMoveFromNotation(p, `e1c1`), queenside)
+	expect.Eq(t, p.san(queenside), `O-O-O`)
+
+	position := p.makeMove(kingside)
+	expect.Eq(t, position.fen(), `1r2k1r1/8/8/8/8/8/8/1R3RK1 b kq - 1 1`)
+	position = position.makeMove(NewCastle(position, E8, B8))
+	expect.Eq(t, position.fen(), `2kr2r1/8/8/8/8/8/8/1R3RK1 w - - 2 2`)
+	position = position.undoLastMove().undoLastMove()
+	expect.Eq(t, position.fen(), `1r2k1r1/8/8/8/8/8/8/1R2K1R1 w KQkq - 0 1`)
+}
+
+// Castling rook should not be the one shielding king's destination.
+func TestCastle030(t *testing.T) {
+	p := NewGame(`4k3/8/8/8/8/8/8/rR1K4 w Q - 0 1`).start()
+	expect.NotContain(t, NewMoveGen(p).generateMoves().allMoves(), `0-0-0`)
+
+	p = NewGame(`4k3/8/8/8/8/8/8/1R1K4 w Q - 0 1`).start()
+	expect.Contain(t, NewMoveGen(p).generateMoves().allMoves(), `0-0-0`)
+}
+
+// Chess960 castle notation used by the GUIs.
+func TestCastle040(t *testing.T) {
+	engine := NewEngine()
+	p := engine.NewGame(`1r2k1r1/8/8/8/8/8/8/1R2K1R1 w KQkq - 0 1`).start()
+	move := NewCastle(p, E1, B1)
+	expect.Eq(t, engine.notation(move), `e1c1`)
+
+	engine.chess960 = true
+	expect.Eq(t, engine.notation(move), `e1b1`)
+
+	engine.cecp = true
+	expect.Eq(t, engine.notation(move), `O-O-O`)
+}
+
+// Chess960 perft.
+func TestCastle050(t *testing.T) {
+	perft := map[string]int64{
+		`bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9`: 326672,
+		`r1k1r2q/p1ppp1pp/8/8/8/8/P1PPP1PP/R1K1R2Q w KQkq - 0 1`:             285754,
+		`r1k2r1q/p1ppp1pp/8/8/8/8/P1PPP1PP/R1K2R1Q w KQkq - 0 1`:             541480,
+		`8/8/8/4B2b/6nN/8/5P2/2R1K2k w Q - 0 1`:                              118388,
+		`2r5/8/8/8/8/8/6PP/k2KR3 w K - 0 1`:                                  57700,
+		`4r3/3k4/8/8/8/8/6PP/qR1K1R2 w KQ - 0 1`:                             405636,
+	}
+	for fen, nodes := range perft {
+		p, err := NewGame(fen).setup()
+		expect.Eq(t, err, nil)
+		expect.Eq(t, p.Perft(4), nodes)
+	}
+}
@@ -10,6 +10,7 @@
 package main
 
 import (
+	`fmt`
 	`github.com/michaeldv/donna`
 	`os`
 	`runtime`
@@ -28,7 +29,14 @@ func main() {
 
 	if len(os.Args) > 1 && os.Args[1] == `-i` {
 		engine.Repl()
+	} else if len(os.Args) > 1 && os.Args[1] == `-x` {
+		engine.Xboard()
+	} else if len(os.Args) > 1 && os.Args[1] == `book` {
+		if err := engine.Book(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 	} else {
-		engine.Uci()
+		engine.Uci() // <-- Switches to XBoard on "xboard" command.
 	}
 }
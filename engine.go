@@ -8,12 +8,17 @@
 
 package donna
 
-import (`fmt`; `os`; `time`)
+import (`fmt`; `math/rand`; `os`; `sync`; `sync/atomic`; `time`)
 
 const Ping = 250 // Check time 4 times a second.
 
+// Clock state is shared between the search and the goroutine that reads GUI
+// commands: the halt flag is atomic, and the mutex guards pondering and
+// starting or stopping the ticker.
 type Clock struct {
-	halt        bool     // Stop search immediately when set to true.
+	sync.Mutex
+	halt        atomic.Bool // Stop search immediately when set to true.
+	running     bool     // Set while the search is using the clock.
 	softStop    int64    // Target soft time limit to make a move.
 	hardStop    int64    // Immediate stop time limit.
 	extra       float32  // Extra time factor based on search volatility.
@@ -22,52 +27,87 @@ type Clock struct {
 }
 
 type Options struct {
-	ponder      bool     // (-) Pondering mode.
-	infinite    bool     // (-) Search until the "stop" command.
+	ponder      bool     // Pondering mode, i.e. searching on opponent's time.
+	infinite    bool     // Search until the "stop" command.
 	maxDepth    int      // Search X plies only.
-	maxNodes    int      // (-) Search X nodes only.
+	maxNodes    int      // Search X nodes only.
 	moveTime    int64    // Search exactly X milliseconds per move.
 	movesToGo   int64    // Number of moves to make till time control.
 	timeLeft    int64    // Time left for all remaining moves.
 	timeInc     int64    // Time increment after the move is made.
+	searchMoves []Move   // Search these root moves only.
+}
+
+// Evaluation weights that could be adjusted by the engine options.
+type Weights struct {
+	mobility      Score
+	pawnStructure Score
+	passedPawns   Score
+	safety        Score
 }
 
 type Engine struct {
-	log         bool     // Enable logging.
 	uci	    bool     // Use UCI protocol.
-	trace       bool     // Trace evaluation scores.
-	fancy       bool     // Represent pieces as UTF-8 characters.
+	cecp        bool     // Use XBoard protocol (CECP).
+	post        bool     // Show thinking output (XBoard).
+	ponder      bool     // Allow pondering, i.e. thinking on opponent's time.
+	ownBook     bool     // Use opening book.
+	bookLearning bool    // Learn from the games played out of the opening book.
+	limitStrength bool   // Play at given Elo rating.
+	chess960    bool     // Use Chess960 castle notation.
 	status      uint8    // Engine status.
 	logFile     string   // Log file name.
-	bookFile    string   // Polyglot opening book file name.
+	bookFile    string   // Polyglot opening book file names in the order of priority.
+	booksFile   string   // Book file names the books were loaded from.
+	books       []*Book  // Opening books loaded into memory.
+	bookDepth   int      // Maximum number of plies to play from the book, 0 for no limit.
 	cacheSize   float64  // Default cache size.
+	threads     int      // Number of search threads.
+	multiPV     int      // Number of principal variations to search.
+	elo         int      // Elo rating when strength is limited.
+	moveOverhead int64   // Time reserve in milliseconds to cover GUI delays.
+	cache       Cache    // Transposition table reused by engine's games.
+	keepCache   bool     // Start next game with the cache loaded from file rather than clearing it.
+	cacheToken  uint8    // Cache token of the loaded cache.
+	hashFile    string   // File name to save the cache to and load it from.
+	weights     Weights  // Evaluation weights.
+	bookPolicy  BookPolicy // How to pick opening book moves.
+	bookRandom  *rand.Rand // Random numbers for picking book moves.
+	fancy       bool     // Represent pieces as UTF-8 characters.
+	logging     bool     // Enable Log() output.
 	clock       Clock
 	options     Options
 }
 
-// Use single statically allocated variable.
-var engine Engine
-
+// Creates new engine instance. Engines are independent of each other so that
+// several of them could be thinking at the same time.
 func NewEngine(args ...interface{}) *Engine {
-	engine = Engine{}
+	engine := &Engine{ multiPV: 1, elo: MaxElo, bookPolicy: defaultBookPolicy }
+	engine.seedBook(0)
+	engine.weights = Weights{ weightMobility, weightPawnStructure, weightPassedPawns, weightSafety }
 	for i := 0; i < len(args); i += 2 {
 		switch value := args[i+1]; args[i] {
 		case `log`:
-			engine.log = value.(bool)
+			engine.logging = value.(bool)
 		case `logfile`:
 			engine.logFile = value.(string)
 		case `bookfile`:
 			engine.bookFile = value.(string)
+			engine.ownBook = engine.bookFile != ``
 		case `uci`:
 			engine.uci = value.(bool)
-		case `trace`:
-			engine.trace = value.(bool)
 		case `fancy`:
 			engine.fancy = value.(bool)
+		case `threads`:
+			engine.threads = value.(int)
 		case `depth`:
 			engine.options.maxDepth = value.(int)
 		case `movetime`:
 			engine.options.moveTime = int64(value.(int))
+		case `nodes`:
+			engine.options.maxNodes = value.(int)
+		case `multipv`:
+			engine.multiPV = value.(int)
 		case `cache`:
 			switch value.(type) {
 			default: // :-)
@@ -78,7 +118,19 @@ func NewEngine(args ...interface{}) *Engine {
 		}
 	}
 
-	return &engine
+	return engine
+}
+
+// Sets random seed for picking opening book moves so that the engine makes the
+// same choices when started with the same seed. Zero seed is based on current
+// time.
+func (e *Engine) seedBook(seed int64) *Engine {
+	if e.bookPolicy.seed = seed; seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	e.bookRandom = rand.New(rand.NewSource(seed))
+
+	return e
 }
 
 // Dumps the string to standard output.
@@ -105,6 +157,22 @@ func (e *Engine) debug(args ...interface{}) *Engine {
 	return e
 }
 
+// Returns the move in coordinate notation expected by the GUI. In Chess960 mode
+// UCI castles are shown as the king taking its own rook, and XBoard ones as
+// O-O or O-O-O.
+func (e *Engine) notation(move Move) string {
+	if e.chess960 && move.isCastle() {
+		if !e.cecp {
+			return move.notation960()
+		} else if move.to() > move.from() {
+			return `O-O`
+		}
+		return `O-O-O`
+	}
+
+	return move.notation()
+}
+
 // Dumps the string to standard output and optionally logs it to file.
 func (e *Engine) reply(args ...interface{}) *Engine {
 	if len := len(args); len > 1 {
@@ -118,6 +186,24 @@ func (e *Engine) reply(args ...interface{}) *Engine {
 	return e
 }
 
+// Stops the search as soon as possible. Could be called from any goroutine.
+func (e *Engine) halt() *Engine {
+	e.clock.Lock(); defer e.clock.Unlock()
+	e.options.ponder = false
+	e.clock.halt.Store(true)
+
+	return e
+}
+
+func (e *Engine) halted() bool {
+	return e.clock.halt.Load()
+}
+
+func (e *Engine) pondering() bool {
+	e.clock.Lock(); defer e.clock.Unlock()
+	return e.options.ponder
+}
+
 func (e *Engine) fixedDepth() bool {
 	return e.options.maxDepth > 0
 }
@@ -127,7 +213,38 @@ func (e *Engine) fixedTime() bool {
 }
 
 func (e *Engine) varyingTime() bool {
-	return e.options.moveTime == 0
+	return !e.options.infinite && e.options.moveTime == 0 && e.options.timeLeft > 0
+}
+
+func (e *Engine) fixedNodes() bool {
+	return e.options.maxNodes > 0
+}
+
+// Returns maximum search depth for the Elo rating when the strength is limited:
+// depth 1 for the weakest 1000 Elo and 13 plies at the top of the scale.
+func (e *Engine) strengthDepth() int {
+	return 1 + (e.elo - MinElo) / 150
+}
+
+// Sets evaluation weight as a percentage of its default value. The weight name
+// is one of `mobility`, `pawnstructure`, `passedpawns`, or `kingsafety`.
+func (e *Engine) weigh(name string, percent int) *Engine {
+	switch name {
+	case `mobility`:
+		e.weights.mobility = weightMobility
+		e.weights.mobility.scale(percent)
+	case `pawnstructure`:
+		e.weights.pawnStructure = weightPawnStructure
+		e.weights.pawnStructure.scale(percent)
+	case `passedpawns`:
+		e.weights.passedPawns = weightPassedPawns
+		e.weights.passedPawns.scale(percent)
+	case `kingsafety`:
+		e.weights.safety = weightSafety
+		e.weights.safety.scale(percent)
+	}
+
+	return e
 }
 
 
@@ -153,12 +270,40 @@ func (e *Engine) factor(depth int, volatility float32) *Engine {
 	return e
 }
 
-// Starts the clock setting ticker callback function. The callback function is
-// different for fixed and variable time controls.
-func (e *Engine) startClock() *Engine {
-	e.clock.halt = false
+// Starts the clock setting ticker callback function for the game that is being
+// searched. The callback function is different for fixed and variable time
+// controls.
+func (e *Engine) startClock(game *Game) *Engine {
+	e.clock.Lock(); defer e.clock.Unlock()
+	e.clock.running = true
+
+	// Pondering is done on opponent's time so the clock only starts ticking
+	// on "ponderhit".
+	if e.options.ponder {
+		return e
+	}
+
+	return e.runClock(game)
+}
+
+// Switches from pondering to regular search once the opponent has made the
+// expected move. The search carries on with its tree and cache intact while
+// the clock starts ticking against the time budget set by varyingLimits().
+// If the search hasn't started yet it will simply start the clock right away.
+func (e *Engine) ponderhit(game *Game) *Engine {
+	e.clock.Lock(); defer e.clock.Unlock()
+	if e.options.ponder {
+		e.options.ponder = false
+		if e.clock.running {
+			e.runClock(game)
+		}
+	}
+
+	return e
+}
 
-	if e.options.moveTime == 0 && e.options.timeLeft == 0 {
+func (e *Engine) runClock(game *Game) *Engine {
+	if e.options.infinite || (e.options.moveTime == 0 && e.options.timeLeft == 0) {
 		return e
 	}
 
@@ -166,15 +311,17 @@ func (e *Engine) startClock() *Engine {
 	e.clock.ticker = time.NewTicker(time.Millisecond * Ping)
 
 	if e.fixedTime() {
-		return e.fixedTimeTicker()
+		return e.fixedTimeTicker(game)
 	}
 
 	// How long a minute is depends on which side of the bathroom door you're on.
-	return e.varyingTimeTicker()
+	return e.varyingTimeTicker(game)
 }
 
 // Stop the clock so that the ticker callback function is longer invoked.
 func (e *Engine) stopClock() *Engine {
+	e.clock.Lock(); defer e.clock.Unlock()
+	e.clock.running = false
 	if e.clock.ticker != nil {
 		e.clock.ticker.Stop()
 		e.clock.ticker = nil
@@ -184,17 +331,15 @@ func (e *Engine) stopClock() *Engine {
 
 // Ticker callback for fixed time control (ex. 5s per move). Search gets terminated
 // when we've got the move and the elapsed time approaches time-per-move limit.
-func (e *Engine) fixedTimeTicker() *Engine {
+func (e *Engine) fixedTimeTicker(game *Game) *Engine {
+	ticker := e.clock.ticker // <-- Stopping the clock resets e.clock.ticker.
 	go func() {
-		if e.clock.ticker == nil {
-			return // Nothing to do if the clock has been stopped.
-		}
-		for now := range e.clock.ticker.C {
+		for now := range ticker.C {
 			if game.rootpv.size == 0 {
 				continue // Haven't found the move yet.
 			}
-			if e.elapsed(now) >= e.options.moveTime - Ping {
-				e.clock.halt = true
+			if e.elapsed(now) >= e.options.moveTime - Ping - e.moveOverhead {
+				e.clock.halt.Store(true)
 				return
 			}
 		}
@@ -205,12 +350,10 @@ func (e *Engine) fixedTimeTicker() *Engine {
 
 // Ticker callback for the variable time control (ex. 40 moves in 5 minutes). Search
 // termination depends on multiple factors with hard stop being the ultimate limit.
-func (e *Engine) varyingTimeTicker() *Engine {
+func (e *Engine) varyingTimeTicker(game *Game) *Engine {
+	ticker := e.clock.ticker // <-- Stopping the clock resets e.clock.ticker.
 	go func() {
-		if e.clock.ticker == nil {
-			return // Nothing to do if the clock has been stopped.
-		}
-		for now := range e.clock.ticker.C {
+		for now := range ticker.C {
 			if game.rootpv.size == 0 {
 				continue // Haven't found the move yet.
 			}
@@ -218,7 +361,7 @@ func (e *Engine) varyingTimeTicker() *Engine {
 			if (game.deepening && game.improving && elapsed > e.remaining() * 4 / 5) || elapsed > e.clock.hardStop {
 				//\\ e.debug("# Halt: Flags %v Elapsed %s Remaining %s Hard stop %s\n",
 				//\\	game.deepening && game.improving, ms(elapsed), ms(e.remaining() * 4 / 5), ms(e.clock.hardStop))
-				e.clock.halt = true
+				e.clock.halt.Store(true)
 				return
 			}
 		}
@@ -236,6 +379,9 @@ func (e *Engine) fixedLimit(options Options) *Engine {
 // Sets variable time control options and calculates soft and hard stop estimates.
 func (e *Engine) varyingLimits(options Options) *Engine {
 
+	// Reserve the time to cover communication delays.
+	options.timeLeft = max64(options.timeLeft - e.moveOverhead, options.timeLeft / 2)
+
 	// Note if it's a new time control before saving the options.
 	e.options = options
 	e.options.ponder = false
@@ -255,6 +401,12 @@ func (e *Engine) varyingLimits(options Options) *Engine {
 	hard := options.timeLeft + options.timeInc * moves
 	soft := hard / e.options.movesToGo
 
+	// Pondering gives us some of the opponent's time so we can afford to
+	// think a bit longer.
+	if e.ponder {
+		soft = min64(soft + soft / 4, hard)
+	}
+
 	//\\ e.debug("#\n# Make %d moves in %s soft stop %s hard stop %s\n", e.options.movesToGo, ms(e.options.timeLeft), ms(soft), ms(hard))
 
 	// Adjust hard stop to leave enough time reserve for the remaining moves. The time
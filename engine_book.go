@@ -0,0 +1,130 @@
+// Copyright (c) 2014-2018 by Michael Dvorkin. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+//
+// I am making my contributions/submissions to this project solely in my
+// personal capacity and am not conveying any rights to any intellectual
+// property of any third parties.
+
+package donna
+
+import (
+	`flag`
+	`fmt`
+	`io/ioutil`
+	`os`
+	`strings`
+)
+
+// Book commands and their arguments.
+const bookUsage = `usage: donna book <command> [arguments]
+
+  build [options] <book.bin> <games.pgn> ...   Build book from PGN games
+  list <book.bin> [fen]                        List book moves for the position
+  dump [options] <book.bin> [fen]              Show book lines up to given depth
+  stats <book.bin>                             Show book statistics`
+
+// Runs opening book command given on the command line, ex.
+//
+//   donna book build -ply 16 -games 3 -rating 2400 book.bin games.pgn
+//   donna book dump -depth 6 -pgn book.bin
+//
+func (e *Engine) Book(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf(bookUsage)
+	}
+
+	switch command := args[0]; command {
+	case `build`:
+		return e.bookBuild(args[1:])
+	case `list`, `dump`, `stats`:
+		return e.bookInspect(command, args[1:])
+	default:
+		return fmt.Errorf("unknown book command: %s\n%s", command, bookUsage)
+	}
+}
+
+// Shows what is in the book: the moves for the position given in FEN (initial
+// one by default), book lines as a tree or PGN, or book statistics.
+func (e *Engine) bookInspect(command string, args []string) error {
+	options := flag.NewFlagSet(`donna book ` + command, flag.ContinueOnError)
+	depth := options.Int(`depth`, 8, `number of plies to show`)
+	pgn := options.Bool(`pgn`, false, `show book lines in PGN format`)
+	if command == `dump` {
+		if err := options.Parse(args); err != nil {
+			return err
+		}
+		args = options.Args()
+	}
+	if len(args) == 0 {
+		return fmt.Errorf(bookUsage)
+	}
+
+	book, err := NewBook(args[0])
+	if err != nil {
+		return err
+	}
+	game := NewGame()
+	if len(args) > 1 {
+		game = NewGame(strings.Join(args[1:], ` `))
+	}
+	position, err := game.setup()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case command == `list`:
+		fmt.Print(book.List(position))
+	case command == `stats`:
+		fmt.Print(book.Stats(position))
+	case *pgn:
+		fmt.Print(book.Pgn(position, *depth))
+	default:
+		fmt.Print(book.Tree(position, *depth))
+	}
+
+	return nil
+}
+
+// Builds polyglot book out of one or more PGN files.
+func (e *Engine) bookBuild(args []string) error {
+	options := flag.NewFlagSet(`donna book build`, flag.ContinueOnError)
+	maxPly := options.Int(`ply`, 20, `maximum number of plies to use from each game`)
+	minGames := options.Int(`games`, 1, `minimum number of games the move should be played in`)
+	minRating := options.Int(`rating`, 0, `minimum rating of the player making the move`)
+	results := options.String(`results`, `1-0,0-1,1/2-1/2`, `comma-separated results of the games to use`)
+	options.Usage = func() {
+		fmt.Fprintln(os.Stderr, `usage: donna book build [options] <book.bin> <games.pgn> ...`)
+		options.PrintDefaults()
+	}
+	if err := options.Parse(args); err != nil {
+		return err
+	}
+	if options.NArg() < 2 {
+		options.Usage()
+		return fmt.Errorf(`missing book or PGN file name`)
+	}
+
+	builder := NewBookBuilder(`maxply`, *maxPly, `mingames`, *minGames, `minrating`, *minRating, `results`, *results)
+	for _, fileName := range options.Args()[1:] {
+		text, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return err
+		}
+		games, err := builder.Add(string(text))
+		if err != nil {
+			return fmt.Errorf(`%s: %v`, fileName, err)
+		}
+		fmt.Printf("%s: %d game(s)\n", fileName, games)
+	}
+
+	bookFile := options.Arg(0)
+	entries, err := builder.Write(bookFile)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: %d entries from %d game(s)\n", bookFile, entries, builder.games)
+
+	return nil
+}
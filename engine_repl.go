@@ -9,9 +9,11 @@
 package donna
 
 import(
+	`bufio`
 	`fmt`
 	`io/ioutil`
-	`regexp`
+	`math/rand`
+	`os`
 	`runtime`
 	`strconv`
 	`strings`
@@ -26,18 +28,46 @@ var (
 	ansiNone  = "\033[0m"
 )
 
-func (e *Engine) replBestMove(move Move) *Engine {
-	fmt.Printf(ansiTeal + "Donna's move: %s", move)
-	if game.nodes == 0 {
+func (e *Engine) replBestMove(game *Game, move Move) *Engine {
+	if len(game.lines) > 1 {
+		e.replLines(game)
+	}
+
+	fmt.Printf(ansiTeal + "Donna's move: %s", game.position().san(move))
+	if nodes, _ := game.totals(); nodes == 0 {
 		fmt.Printf(" (book)")
 	}
-	fmt.Println(ansiNone + "\n")
+	fmt.Print(ansiNone + "\n\n")
+
+	return e
+}
+
+// Prints MultiPV lines ranked by score.
+func (e *Engine) replLines(game *Game) *Engine {
+	fmt.Println(ansiWhite + `Rank    Score   Principal variation` + ansiNone)
+	position := game.position()
+	for i, line := range game.lines {
+		score := line.score
+		if game.position().color == Black {
+			score = -score
+		}
+		if isMate(score) {
+			fmt.Printf("%4d %7dX   %s\n", i + 1, (Checkmate - abs(score)) / 2 + 1, position.sanLine(line.pv.moves[0:line.pv.size]))
+		} else {
+			fmt.Printf("%4d %8.2f   %s\n", i + 1, float32(score) / float32(onePawn), position.sanLine(line.pv.moves[0:line.pv.size]))
+		}
+	}
 
 	return e
 }
 
-func (e *Engine) replPrincipal(depth, score, status int, duration int64) {
-	fmt.Printf(`%2d %s %9d %9d %8.1fK %6.1f%%  `, depth, ms(duration), game.nodes, game.qnodes, float32(nps(duration)) / 1000.0, float32(hashfull()) / 10.0)
+func (e *Engine) replPrincipal(game *Game, depth, score, status int, duration int64) {
+	if game.line > 0 {
+		return // Secondary MultiPV lines are shown when the search is over.
+	}
+
+	nodes, qnodes := game.totals()
+	fmt.Printf(`%2d %s %9d %9d %8.1fK %6.1f%%  `, depth, ms(duration), nodes, qnodes, float32(game.nps(duration)) / 1000.0, float32(game.hashfull()) / 10.0)
 	switch status {
 	case WhiteWon:
 		fmt.Println(`1-0 White Checkmates`)
@@ -50,9 +80,9 @@ func (e *Engine) replPrincipal(depth, score, status int, duration int64) {
 	case FiftyMoves:
 		fmt.Println(`1/2 Fifty Moves`)
 	case WhiteWinning, BlackWinning: // Show moves till checkmate.
-		fmt.Printf("%6dX   %v Checkmate\n", (Checkmate - abs(score)) / 2 + 1, game.rootpv.moves[0:game.rootpv.size])
+		fmt.Printf("%6dX   %s Checkmate\n", (Checkmate - abs(score)) / 2 + 1, game.position().sanLine(game.rootpv.moves[0:game.rootpv.size]))
 	default:
-		fmt.Printf("%7.2f   %v\n", float32(score) / float32(onePawn), game.rootpv.moves[0:game.rootpv.size])
+		fmt.Printf("%7.2f   %s\n", float32(score) / float32(onePawn), game.position().sanLine(game.rootpv.moves[0:game.rootpv.size]))
 	}
 }
 
@@ -69,7 +99,7 @@ func (e *Engine) Repl() *Engine {
 
 	setup := func() {
 		if game == nil || position == nil {
-			game = NewGame()
+			game = e.NewGame()
 			position = game.start()
 			fmt.Printf("%s\n", position)
 		}
@@ -77,16 +107,164 @@ func (e *Engine) Repl() *Engine {
 
 	think := func() {
 		if move := game.Think(); move != 0 {
-			position = position.makeMove(move)
+			position = game.makeMove(move)
 			fmt.Printf("%s\n", position)
 		}
 	}
 
-	book := func(fileName string) {
-		if e.bookFile = fileName; e.bookFile == `` {
+	// Parses the moves to restrict the search to, ex. "go e2e4 d2d4".
+	searchMoves := func(args []string) (moves []Move, ok bool) {
+		for _, arg := range args {
+			move, validMoves := NewMoveFromString(position, arg)
+			if move == 0 {
+				fmt.Printf("%s appears to be an invalid move; valid moves are %v\n", arg, position.sanList(validMoves))
+				return nil, false
+			}
+			moves = append(moves, move)
+		}
+		return moves, true
+	}
+
+	// Saves the cache to file or loads it back, ex. "hash save analysis.tt".
+	hash := func(args []string) {
+		if len(args) != 2 || (args[0] != `save` && args[0] != `load`) {
+			fmt.Println(`Usage: hash save <file> or hash load <file>`)
+			return
+		}
+
+		var err error
+		if args[0] == `save` {
+			if game == nil {
+				err = fmt.Errorf(`no search to save`)
+			} else if err = game.SaveCache(args[1]); err == nil {
+				fmt.Printf("Saved hash to %s\n", args[1])
+			}
+		} else {
+			if game == nil {
+				_, err = e.LoadCache(args[1])
+			} else {
+				err = game.LoadCache(args[1])
+			}
+			if err == nil {
+				fmt.Printf("Loaded hash from %s\n", args[1])
+			}
+		}
+		if err != nil {
+			fmt.Printf("Hash error: %v\n", err)
+		}
+	}
+
+	// Learns from the outcome of the game that is about to be replaced.
+	learn := func() {
+		if game != nil {
+			game.learnOutcome(game.outcome())
+		}
+	}
+
+	// Describes how book moves get picked.
+	bookSettings := func() string {
+		settings := e.bookPolicy.String()
+		if e.bookDepth > 0 {
+			settings += fmt.Sprintf(`, up to %d plies`, e.bookDepth)
+		}
+		if e.bookLearning {
+			settings += `, learning`
+		}
+		return settings
+	}
+
+	// Shows book moves for current position, book lines up to given depth
+	// as a tree or PGN, or book statistics, ex. "book dump 6 pgn".
+	inspect := func(args []string) {
+		books, err := e.openBooks()
+		if err != nil {
+			fmt.Printf("Book error: %v\n", err)
+			return
+		} else if len(books) == 0 {
+			fmt.Println(`Using no opening book`)
+			return
+		}
+		setup()
+
+		depth := 8
+		if len(args) > 1 {
+			if depth, err = strconv.Atoi(args[1]); err != nil || depth < 1 {
+				fmt.Println(`Book depth must be a positive number of plies`)
+				return
+			}
+		}
+		for _, book := range books {
+			if len(books) > 1 {
+				fmt.Printf("%s:\n", book.fileName)
+			}
+			book.with(e.bookPolicy, e.bookRandom, e.bookLearning)
+			switch {
+			case args[0] == `list`:
+				fmt.Print(book.List(position))
+			case args[0] == `stats`:
+				fmt.Print(book.Stats(position))
+			case len(args) > 2 && args[2] == `pgn`:
+				fmt.Print(book.Pgn(position, depth))
+			default:
+				fmt.Print(book.Tree(position, depth))
+			}
+		}
+	}
+
+	// Either sets the opening book file or changes its move selection policy,
+	// ex. "book policy weighted" or "book seed 42".
+	book := func(args []string) {
+		if len(args) > 0 && strings.Contains(` policy top weight seed learn depth `, ` ` + args[0] + ` `) {
+			if len(args) < 2 {
+				fmt.Printf("Picking book moves: %s\n", bookSettings())
+				return
+			}
+			n, err := strconv.Atoi(args[1])
+			switch args[0] {
+			case `policy`:
+				if !e.bookPolicy.set(args[1]) {
+					fmt.Printf("Unknown book policy %s; valid ones are %v\n", args[1], bookPolicies)
+					return
+				}
+			case `top`:
+				if err != nil || n < 1 || n > 32 {
+					fmt.Println(`The number of top moves must be between 1 and 32`)
+					return
+				}
+				e.bookPolicy.top = n
+			case `weight`:
+				if err != nil || n < 0 || n > 65535 {
+					fmt.Println(`Minimum weight must be between 0 and 65535`)
+					return
+				}
+				e.bookPolicy.minWeight = n
+			case `seed`:
+				if err != nil || n < 0 {
+					fmt.Println(`Random seed must be a non-negative number`)
+					return
+				}
+				e.seedBook(int64(n))
+			case `learn`:
+				e.bookLearning = (args[1] == `on`)
+			case `depth`:
+				if err != nil || n < 0 {
+					fmt.Println(`Book depth must be a non-negative number of plies`)
+					return
+				}
+				e.bookDepth = n
+			}
+			fmt.Printf("Picking book moves: %s\n", bookSettings())
+		} else if len(args) == 0 {
+			e.bookFile, e.ownBook = ``, false
 			fmt.Println(`Using no opening book`)
 		} else {
-			fmt.Printf("Using opening book %s\n", fileName)
+			e.bookFile, e.ownBook = strings.Join(args, string(os.PathListSeparator)), true
+			if _, err := e.openBooks(); err != nil {
+				e.bookFile, e.ownBook = ``, false
+				fmt.Printf("Book error: %v\n", err)
+				return
+			}
+			fmt.Printf("Using opening book %s (%s)\n", strings.Join(args, `, `), bookSettings())
 		}
 	}
 
@@ -95,34 +273,46 @@ func (e *Engine) Repl() *Engine {
 		e.options.maxDepth, e.options.moveTime = 0, 10000
 		defer func() {
 			e.options.maxDepth, e.options.moveTime = maxDepth, moveTime
-			if err := recover(); err != nil {
-				fmt.Printf("Error loading %s\n", fileName)
-			}
 		}()
 
 		content, err := ioutil.ReadFile(fileName)
 		if err == nil {
 			total, solved := 0, 0
-			re := regexp.MustCompile(`[\s\+\?!]`)
-
-			NextLine:
 			for _, line := range strings.Split(string(content), "\n") {
-				if len(line) > 0 && line[0] != '#' {
-					total++
-					game := NewGame(line)
-					position := game.start()
-
-					best := strings.Split(line, ` # `)[1] // TODO: add support for "am" (avoid move).
-					fmt.Printf(ansiTeal + "%d) %s for %s" + ansiNone + "\n%s\n", total, best, C(position.color), position)
-					move := game.Think()
-
-					for _, nextBest := range strings.Split(best, ` `) {
-						if move.str() == re.ReplaceAllLiteralString(nextBest, ``) {
-							solved++
-							fmt.Printf(ansiGreen + "%d) Solved (%d/%d %2.1f%%)\n\n\n" + ansiNone, total, solved, total - solved, float32(solved) * 100.0 / float32(total))
-							continue NextLine
-						}
+				if line = strings.TrimSpace(line); len(line) == 0 || line[0] == '#' {
+					continue
+				}
+
+				// Benchmark files come either in EPD or in Donna Chess Format
+				// followed by the best move(s), ex. `Kg1,Qd5,... : Kg8,... # Qd5xf7+!`
+				var game *Game
+				var epd *Epd
+				var position *Position
+				if dcf := strings.Split(line, ` # `); len(dcf) == 2 && strings.Contains(dcf[0], ` : `) {
+					game = e.NewGame(dcf[0])
+					if position, err = game.setup(); err == nil {
+						epd = NewEpdFromPosition(position).Set(`bm`, strings.Fields(dcf[1])...)
 					}
+				} else if epd, err = NewEpd(line); err == nil {
+					game = e.NewGame(epd.Fen())
+					position, err = game.setup()
+				}
+				if err != nil {
+					fmt.Printf("Skipping invalid position %s: %v\n", line, err)
+					continue
+				}
+
+				total++
+				if id := epd.operand(`id`); id != `` {
+					fmt.Printf(ansiTeal + "%d) %s: %s for %s" + ansiNone + "\n%s\n", total, id, epd.targets(), C(position.color), position)
+				} else {
+					fmt.Printf(ansiTeal + "%d) %s for %s" + ansiNone + "\n%s\n", total, epd.targets(), C(position.color), position)
+				}
+				e.clock.halt.Store(false)
+				if epd.solved(position, game.think()) {
+					solved++
+					fmt.Printf(ansiGreen + "%d) Solved (%d/%d %2.1f%%)\n\n\n" + ansiNone, total, solved, total - solved, float32(solved) * 100.0 / float32(total))
+				} else {
 					fmt.Printf(ansiRed + "%d) Not solved (%d/%d %2.1f%%)\n\n\n" + ansiNone, total, solved, total - solved, float32(solved) * 100.0 / float32(total))
 				}
 			}
@@ -131,75 +321,228 @@ func (e *Engine) Repl() *Engine {
 		}
 	}
 
-	perft := func(parameter string) {
-		if parameter == `` {
-			parameter = `5`
+	// Shows current position in FEN, or sets up new game with the position
+	// given in FEN or Donna Chess Format.
+	fen := func(args []string) {
+		if len(args) == 0 {
+			setup()
+			fmt.Printf("%s\n", position.fen())
+			return
+		}
+		loaded := e.NewGame(strings.Join(args, ` `))
+		if started, err := loaded.setup(); err != nil {
+			fmt.Printf("Invalid position: %v\n", err)
+		} else {
+			game, position = loaded, started
+			fmt.Printf("%s\n", position)
+		}
+	}
+
+	// Loads n-th game from PGN file and makes all its moves.
+	load := func(fileName string, n int) {
+		content, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			fmt.Printf("Could not open PGN file '%s'\n", fileName)
+			return
+		}
+		if loaded, err := e.NewGameFromPgn(string(content), n); err != nil {
+			fmt.Printf("Error loading %s: %v\n", fileName, err)
+		} else {
+			game, position = loaded, loaded.position()
+			fmt.Printf("%s\n", position)
+		}
+	}
+
+	save := func(fileName string) {
+		if err := ioutil.WriteFile(fileName, []byte(game.Pgn()), 0644); err != nil {
+			fmt.Printf("Could not save PGN file '%s'\n", fileName)
+		} else {
+			fmt.Printf("Saved %d move(s) to %s\n", len(game.moves), fileName)
+		}
+	}
+
+	// Runs perft for the current position or the one given in FEN or DCF,
+	// ex. "perft 4 divide stats r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1". The
+	// "fast" perft uses all CPUs and the hash table of engine's cache size.
+	perft := func(args []string) {
+		depth, divide, detailed, fast := 5, false, false, false
+		if len(args) > 0 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 0 || n >= MaxPly {
+				fmt.Printf("Perft depth must be between 0 and %d\n", MaxPly - 1)
+				return
+			}
+			depth, args = n, args[1:]
+		}
+		for len(args) > 0 && (args[0] == `divide` || args[0] == `stats` || args[0] == `fast`) {
+			divide, detailed, fast = divide || args[0] == `divide`, detailed || args[0] == `stats`, fast || args[0] == `fast`
+			args = args[1:]
+		}
+		if fast && detailed {
+			fmt.Printf("Fast perft counts nodes only\n")
+			return
+		}
+
+		p := position
+		if len(args) > 0 {
+			var err error
+			if p, err = e.NewGame(strings.Join(args, ` `)).setup(); err != nil {
+				fmt.Printf("Invalid position: %v\n", err)
+				return
+			}
+		} else {
+			setup()
+			p = position
 		}
-		if depth, err := strconv.Atoi(parameter); err == nil {
-			position := NewGame().start()
-			start := time.Now()
-			total := position.Perft(depth)
-			finish := since(start)
-			fmt.Printf("  Depth: %d\n", depth)
-			fmt.Printf("  Nodes: %d\n", total)
-			fmt.Printf("Elapsed: %s\n", ms(finish))
-			fmt.Printf("Nodes/s: %dK\n", total / finish)
+
+		var stats PerftStats
+		start := time.Now()
+		if fast && divide {
+			for _, perft := range p.PerftParallel(depth, runtime.NumCPU(), int(e.cacheSize)) {
+				fmt.Printf("  %-8s %d\n", p.san(perft.Move), perft.Stats.Nodes)
+				stats.add(perft.Stats)
+			}
+			fmt.Println()
+		} else if fast {
+			stats.Nodes = p.PerftHashed(depth, runtime.NumCPU(), int(e.cacheSize))
+		} else if divide {
+			for _, perft := range p.PerftDivide(depth, detailed) {
+				fmt.Printf("  %-8s %d\n", p.san(perft.Move), perft.Stats.Nodes)
+				stats.add(perft.Stats)
+			}
+			fmt.Println()
+		} else if detailed {
+			stats = p.PerftStats(depth)
+		} else {
+			stats.Nodes = p.Perft(depth)
 		}
+		finish := since(start)
+
+		fmt.Printf("     Depth: %d\n", depth)
+		fmt.Printf("     Nodes: %d\n", stats.Nodes)
+		if detailed {
+			fmt.Printf("  Captures: %d\n", stats.Captures)
+			fmt.Printf("Enpassants: %d\n", stats.Enpassants)
+			fmt.Printf("   Castles: %d\n", stats.Castles)
+			fmt.Printf("Promotions: %d\n", stats.Promotions)
+			fmt.Printf("    Checks: %d\n", stats.Checks)
+			fmt.Printf("Checkmates: %d\n", stats.Checkmates)
+		}
+		fmt.Printf("   Elapsed: %s\n", ms(finish))
+		fmt.Printf("   Nodes/s: %dK\n", stats.Nodes / max64(1, finish))
 	}
 
 	fmt.Printf("Donna v%s Copyright (c) 2014-2018 by Michael Dvorkin. All Rights Reserved.\nType ? for help.\n\n", Version)
-	for command, parameter := ``, ``; ; command, parameter = ``, `` {
+	bio := bufio.NewReader(os.Stdin)
+	for {
 		fmt.Print(`donna> `)
-		fmt.Scanln(&command, &parameter)
+		input, err := bio.ReadString('\n')
+		if err != nil && input == `` {
+			return e // <-- End of input.
+		}
+
+		// Most commands take one parameter, and some take a few.
+		command, parameter, args := ``, ``, strings.Fields(input)
+		if len(args) > 0 {
+			command, args = args[0], args[1:]
+		}
+		if len(args) > 0 {
+			parameter = args[0]
+		}
 
 		switch command {
 		case ``:
 		case `bench`:
 			benchmark(parameter)
 		case `book`:
-			book(parameter)
+			if parameter == `list` || parameter == `dump` || parameter == `stats` {
+				inspect(args)
+			} else {
+				book(args)
+			}
 		case `exit`, `quit`:
 			return e
+		case `fen`:
+			fen(args)
 		case `go`:
 			setup()
-			think()
+			if moves, ok := searchMoves(args); ok {
+				e.options.searchMoves = moves
+				think()
+				e.options.searchMoves = nil
+			}
+		case `hash`:
+			hash(args)
 		case `help`, `?`:
-			fmt.Println("The commands are:\n\n" +
+			fmt.Print("The commands are:\n\n" +
 				"  bench <file>   Run benchmarks\n" +
-				"  book <file>    Use opening book\n" +
+				"  book <files>   Use opening books, or set book policy, top, weight, seed, learn, or depth\n" +
+				"  book list      Show book moves; also book dump [depth] [pgn] and book stats\n" +
 				"  exit           Exit the program\n" +
-				"  go             Take side and make a move\n" +
+				"  fen [position] Show FEN or set up the position given in FEN or DCF\n" +
+				"  go [moves]     Take side and make a move, optionally one of the given moves\n" +
+				"  hash save <f>  Save transposition table to file; hash load <f> loads it back\n" +
 				"  help           Display this help\n" +
+				"  load <pgn> [n] Load n-th game from PGN file\n" +
+				"  multipv <n>    Show n best lines\n" +
 				"  new            Start new game\n" +
-				"  perft [depth]  Run perft test\n" +
+				"  new960 [n]     Start new Chess960 game, random one unless n is given\n" +
+				"  perft [depth]  Run perft test, optionally followed by divide, stats or fast, and position\n" +
+				"  save <pgn>     Save the game to PGN file\n" +
 				"  score          Show evaluation summary\n" +
 				"  undo           Undo last move\n\n" +
-				"To make a move use algebraic notation, for example e2e4, Ng1f3, or e7e8Q\n")
+				"To make a move use algebraic notation, for example e4, Nf3, O-O, or e8=Q\n\n")
+		case `load`:
+			n := 1
+			if len(args) > 1 {
+				n, _ = strconv.Atoi(args[1])
+			}
+			load(parameter, n)
+		case `multipv`:
+			if n, err := strconv.Atoi(parameter); err == nil && n >= 1 && n <= MaxMultiPV {
+				e.multiPV = n
+			}
+			fmt.Printf("Showing %d best line(s)\n", e.multiPV)
 		case `new`:
+			learn()
 			game, position = nil, nil
 			setup()
+		case `new960`:
+			n := rand.Intn(960)
+			if parameter != `` {
+				if number, err := strconv.Atoi(parameter); err == nil && number >= 0 && number < 960 {
+					n = number
+				} else {
+					fmt.Printf("Chess960 position number must be between 0 and 959\n")
+					break
+				}
+			}
+			learn()
+			game = e.NewGame(chess960Fen(n))
+			position = game.start()
+			fmt.Printf("Chess960 position #%d\n%s\n", n, position)
 		case `perft`:
-			perft(parameter)
+			perft(args)
+		case `save`:
+			setup()
+			save(parameter)
 		case `score`:
 			setup()
 			_, metrics := position.EvaluateWithTrace()
 			Summary(metrics)
 		case `undo`:
 			if position != nil {
-				position = position.undoLastMove()
+				position = game.undoLastMove()
 				fmt.Printf("%s\n", position)
 			}
 		default:
 			setup()
 			if move, validMoves := NewMoveFromString(position, command); move != 0 {
-				position = position.makeMove(move)
+				position = game.makeMove(move)
 				think()
 			} else { // Invalid move or non-evasion on check.
-				fancy := e.fancy; e.fancy = false
-				fmt.Printf("%s appears to be an invalid move; valid moves are %v\n", command, validMoves)
-				e.fancy = fancy
+				fmt.Printf("%s appears to be an invalid move; valid moves are %v\n", command, position.sanList(validMoves))
 			}
 		}
 	}
-	return e
 }
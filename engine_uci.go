@@ -15,6 +15,8 @@ import (
 	`os`
 	`strconv`
 	`strings`
+	`sync`
+	`time`
 )
 
 func (e *Engine) uciScore(depth, score, alpha, beta int) *Engine {
@@ -35,19 +37,35 @@ func (e *Engine) uciScore(depth, score, alpha, beta int) *Engine {
 		str += " lowerbound"
 	}
 
-	return engine.reply(str + "\n")
+	return e.reply(str + "\n")
 }
 
 func (e *Engine) uciMove(move Move, moveno, depth int) *Engine {
-	return engine.reply("info depth %d currmove %s currmovenumber %d\n", depth, move.notation(), moveno)
+	return e.reply("info depth %d currmove %s currmovenumber %d\n", depth, e.notation(move), moveno)
 }
 
-func (e *Engine) uciBestMove(move Move, duration int64) *Engine {
-	return engine.reply("info nodes %d time %d\nbestmove %s\n", game.nodes + game.qnodes, duration, move.notation())
+func (e *Engine) uciBestMove(game *Game, move Move, duration int64) *Engine {
+	nodes, qnodes := game.totals()
+	e.reply("info nodes %d time %d\n", nodes + qnodes, duration)
+
+	// Suggest opponent's reply from the principal variation to ponder on.
+	if pv := &game.rootpv; pv.size > 1 && pv.moves[0] == move {
+		return e.reply("bestmove %s ponder %s\n", e.notation(move), e.notation(pv.moves[1]))
+	}
+	return e.reply("bestmove %s\n", e.notation(move))
 }
 
-func (e *Engine) uciPrincipal(depth, score int, duration int64) *Engine {
-	str := fmt.Sprintf("info depth %d score", depth)
+func (e *Engine) uciProgress(game *Game, duration int64) *Engine {
+	nodes, qnodes := game.totals()
+	return e.reply("info nodes %d nps %d hashfull %d time %d\n", nodes + qnodes, game.nps(duration), game.hashfull(), duration)
+}
+
+func (e *Engine) uciPrincipal(game *Game, depth, score int, duration int64) *Engine {
+	str := fmt.Sprintf("info depth %d seldepth %d", depth, game.threads[0].seldepth)
+	if len(game.lines) > 1 {
+		str += fmt.Sprintf(" multipv %d", game.line + 1)
+	}
+	str += " score"
 
 	if !isMate(score) {
 		str += fmt.Sprintf(" cp %d", score * 100 / onePawn)
@@ -58,13 +76,46 @@ func (e *Engine) uciPrincipal(depth, score int, duration int64) *Engine {
 		}
 		str += fmt.Sprintf(" mate %d", mate / 2)
 	}
-	str += fmt.Sprintf(" nodes %d nps %d hashfull %d time %d pv", game.nodes + game.qnodes, nps(duration), hashfull(), duration)
+	nodes, qnodes := game.totals()
+	str += fmt.Sprintf(" nodes %d nps %d hashfull %d time %d pv", nodes + qnodes, game.nps(duration), game.hashfull(), duration)
 
-	for i := 0; i < game.rootpv.size; i++ {
-		str += " " + game.rootpv.moves[i].notation()
+	pv := &game.lines[game.line].pv
+	for i := 0; i < pv.size; i++ {
+		str += " " + e.notation(pv.moves[i])
 	}
 
-	return engine.reply(str + "\n")
+	return e.reply(str + "\n")
+}
+
+// Replies to custom "go perft <depth> [stats]" command with node counts for
+// each root move followed by the totals.
+func (e *Engine) uciPerft(position *Position, depth int, detailed bool) *Engine {
+	var stats PerftStats
+
+	// Node counts alone could be hashed and split across the threads.
+	divide := position.PerftParallel
+	if detailed {
+		divide = func(depth, _, _ int) []PerftMove {
+			return position.PerftDivide(depth, true)
+		}
+	}
+
+	start := time.Now()
+	for _, perft := range divide(depth, max(1, e.threads), int(e.cacheSize)) {
+		e.reply("%s: %d\n", e.notation(perft.Move), perft.Stats.Nodes)
+		stats.add(perft.Stats)
+	}
+	if depth == 0 {
+		stats.Nodes = 1
+	}
+	duration := since(start)
+
+	e.reply("\nNodes searched: %d\n", stats.Nodes)
+	if detailed {
+		e.reply("info string captures %d enpassants %d castles %d promotions %d checks %d checkmates %d\n",
+			stats.Captures, stats.Enpassants, stats.Castles, stats.Promotions, stats.Checks, stats.Checkmates)
+	}
+	return e.reply("info nodes %d time %d nps %d\n", stats.Nodes, duration, stats.Nodes * 1000 / max64(1, duration))
 }
 
 // Brain-damaged universal chess interface (UCI) protocol as described at
@@ -72,8 +123,19 @@ func (e *Engine) uciPrincipal(depth, score int, duration int64) *Engine {
 func (e *Engine) Uci() *Engine {
 	var game *Game
 	var position *Position
+	var thinking sync.WaitGroup
 
 	e.uci = true
+	defaults := e.options // Search limits when "go" command has none.
+
+	// "stop" command handler: halts the search running in the background and
+	// waits for it to report the best move. Commands that change the game or
+	// engine settings call it too since well-behaved GUIs stop the search
+	// first anyway.
+	doStop := func(args []string) {
+		e.halt()
+		thinking.Wait()
+	}
 
 	// "uci" command handler.
 	doUci := func(args []string) {
@@ -81,16 +143,42 @@ func (e *Engine) Uci() *Engine {
 		e.reply("id name Donna %s\n", Version)
 		e.reply("id author Michael Dvorkin\n")
 		e.reply("option name Hash type spin default 256 min 32 max 1024\n")
-		// e.reply("option name Mobility type spin default %d min 0 max 100\n", weightMobility.midgame)
-		// e.reply("option name PawnStructure type spin default %d min 0 max 100\n", weightPawnStructure.midgame)
-		// e.reply("option name PassedPawns type spin default %d min 0 max 100\n", weightPassedPawns.midgame)
-		// e.reply("option name KingSafety type spin default %d min 0 max 100\n", weightOurKingSafety.midgame)
-		// e.reply("option name OppositeKingSafety type spin default %d min 0 max 100\n", weightTheirKingSafety.midgame)
+		e.reply("option name Clear Hash type button\n")
+		e.reply("option name Hash File type string default <empty>\n")
+		e.reply("option name Save Hash to File type button\n")
+		e.reply("option name Load Hash from File type button\n")
+		e.reply("option name Threads type spin default 1 min 1 max %d\n", MaxThreads)
+		e.reply("option name Ponder type check default false\n")
+		e.reply("option name OwnBook type check default %v\n", e.ownBook)
+		if e.bookFile != `` {
+			e.reply("option name BookFile type string default %s\n", e.bookFile)
+		} else {
+			e.reply("option name BookFile type string default <empty>\n")
+		}
+		e.reply("option name BookPolicy type combo default %s var uniform var best var weighted\n", bookPolicies[e.bookPolicy.kind])
+		e.reply("option name BookTopMoves type spin default %d min 1 max 32\n", e.bookPolicy.top)
+		e.reply("option name BookMinWeight type spin default %d min 0 max 65535\n", e.bookPolicy.minWeight)
+		e.reply("option name BookSeed type spin default %d min 0 max 2147483647\n", e.bookPolicy.seed)
+		e.reply("option name BookLearning type check default %v\n", e.bookLearning)
+		e.reply("option name BookDepth type spin default %d min 0 max 255\n", e.bookDepth)
+		e.reply("option name MultiPV type spin default 1 min 1 max %d\n", MaxMultiPV)
+		e.reply("option name UCI_LimitStrength type check default false\n")
+		e.reply("option name UCI_Elo type spin default %d min %d max %d\n", MaxElo, MinElo, MaxElo)
+		e.reply("option name UCI_Chess960 type check default false\n")
+		e.reply("option name Move Overhead type spin default 0 min 0 max 5000\n")
+		e.reply("option name Mobility type spin default 100 min 0 max 200\n")
+		e.reply("option name PawnStructure type spin default 100 min 0 max 200\n")
+		e.reply("option name PassedPawns type spin default 100 min 0 max 200\n")
+		e.reply("option name KingSafety type spin default 100 min 0 max 200\n")
 		e.reply("uciok\n")
 	}
 
 	// "ucinewgame" command handler.
 	doUciNewGame := func(args []string) {
+		doStop(nil)
+		if game != nil {
+			game.learnOutcome(game.outcome()) // Learn from checkmates, if any.
+		}
 		game, position = nil, nil
 	}
 
@@ -101,15 +189,22 @@ func (e *Engine) Uci() *Engine {
 
 	// "position [startpos | fen ] [ moves ... ]" command handler.
 	doPosition := func(args []string) {
+		doStop(nil)
+
 		// Make sure we've started the game since "ucinewgame" is optional.
 		if game == nil || position == nil {
-			game = NewGame()
+			game = e.NewGame()
+		}
+
+		if len(args) == 0 {
+			return
 		}
 
+		var err error
 		switch args[0] {
 		case `startpos`:
 			args = args[1:]
-			position = game.start()
+			game.initial = initialFen
 		case `fen`:
 			fen := []string{}
 			for _, token := range args[1:] {
@@ -120,30 +215,51 @@ func (e *Engine) Uci() *Engine {
 				fen = append(fen, token)
 			}
 			game.initial = strings.Join(fen, ` `)
-			position = game.start()
 		default:
 			return
 		}
+		if position, err = game.setup(); err != nil {
+			e.reply("info string invalid position: %v\n", err)
+			return
+		}
 
-		if position != nil && len(args) > 0 && args[0] == `moves` {
-			for _, move := range args[1:] {
-				args = args[1:] // Shift the move.
-				position = position.makeMove(NewMoveFromNotation(position, move))
+		if len(args) > 0 && args[0] == `moves` {
+			for _, notation := range args[1:] {
+				move, _ := NewMoveFromString(position, notation)
+				if move == 0 {
+					e.reply("info string invalid move: %s\n", notation)
+					return
+				}
+				position = game.makeMove(move)
 			}
 		}
 	}
 
-	// "go [[wtime winc | btime binc ] movestogo] | depth | nodes | movetime"
+	// "go [[wtime winc | btime binc ] movestogo] | depth | nodes | movetime |
+	// infinite | ponder | searchmoves ..."
 	doGo := func(args []string) {
-		think := true
-		options := e.options
+		doStop(nil)
+		if position == nil {
+			e.reply("info string no valid position to search\n")
+			e.reply("bestmove 0000\n")
+			return
+		}
+		if len(args) > 1 && args[0] == `perft` {
+			if depth, err := strconv.Atoi(args[1]); err == nil && depth >= 0 && depth < MaxPly {
+				e.uciPerft(position, depth, len(args) > 2 && args[2] == `stats`)
+			}
+			return
+		}
+		think, ponder, infinite := true, false, false
+		options, searchMoves := defaults, []Move(nil) // <-- Limits of the previous search are gone.
+		options.infinite, options.ponder, options.searchMoves = false, false, nil
 
 		for i, token := range args {
 			// Boolen "infinite" and "ponder" commands have no arguments.
 			if token == `infinite` {
-				options = Options{infinite: true}
+				infinite = true
 			} else if token == `ponder` {
-				options = Options{ponder: true}
+				ponder = true
 			} else if token == `test` { // <-- Custom token for use in tests.
 				think = false
 			} else if len(args) > i+1 {
@@ -188,34 +304,167 @@ func (e *Engine) Uci() *Engine {
 					if n, err := strconv.Atoi(args[i+1]); err == nil {
 						options.movesToGo = int64(n)
 					}
+				case `searchmoves`:
+					// The moves go till the end of the command or the first
+					// token that is not a legal move.
+					legal := position.LegalMoves()
+					NextMove:
+					for _, notation := range args[i+1:] {
+						for _, move := range legal {
+							if e.notation(move) == notation {
+								searchMoves = append(searchMoves, move)
+								continue NextMove
+							}
+						}
+						break
+					}
 				}
 			}
 		}
-		if options.timeLeft != 0 || options.timeInc != 0 || options.movesToGo != 0 {
+		if infinite {
+			e.fixedLimit(Options{ infinite: true }) // <-- Ignore any other limits.
+		} else if options.timeLeft != 0 || options.timeInc != 0 || options.movesToGo != 0 {
 			e.varyingLimits(options)
 		} else {
 			e.fixedLimit(options)
 		}
+		e.options.ponder, e.options.searchMoves = ponder, searchMoves
 
 		// Start "thinking" and come up with best move unless when running
-		// tests where we verify argument parsing only.
+		// tests where we verify argument parsing only. The search goes on in
+		// the background so that we could hear "stop" or "ponderhit".
 		if think {
-			game.Think()
+			e.clock.halt.Store(false)
+			thinking.Add(1)
+			go func() {
+				defer thinking.Done()
+				game.think()
+			}()
 		}
 	}
 
-	// Stop calculating as soon as possible.
-	doStop := func(args []string) {
-		e.clock.halt = true
+	// The opponent has played the move we've been pondering on: keep thinking
+	// but now on our own time.
+	doPonderHit := func(args []string) {
+		if game != nil {
+			e.ponderhit(game)
+		}
 	}
 
-	// Set UCI option. So far we only support "setoption name Hash value 32..1024".
+	// "setoption name <id> [value <x>]" command handler. Option names are
+	// case insensitive and might have several words, ex. "Clear Hash". The
+	// spaces between the words do not matter, so that "Book File" is the same
+	// as "BookFile".
 	doSetOption := func(args []string) {
-		if len(args) == 4 && args[0] == `name` && args[1] == `Hash` && args[2] == `value` {
-			if n, err := strconv.Atoi(args[3]); err == nil && n >= 32 && n <= 1024 {
+		doStop(nil)
+		if len(args) < 2 || args[0] != `name` {
+			return
+		}
+
+		name, value := strings.Join(args[1:], ` `), ``
+		for i, token := range args {
+			if token == `value` {
+				name, value = strings.Join(args[1:i], ` `), strings.Join(args[i+1:], ` `)
+				break
+			}
+		}
+
+		// Returns numeric option value if it's within the given range.
+		spin := func(min, max int) (int, bool) {
+			n, err := strconv.Atoi(value)
+			return n, err == nil && n >= min && n <= max
+		}
+
+		switch option := strings.ToLower(strings.Replace(name, ` `, ``, -1)); option {
+		case `hash`:
+			if n, ok := spin(32, 1024); ok {
 				e.cacheSize = float64(n)
 				game, position = nil, nil // Make sure the game gets restarted.
 			}
+		case `clearhash`:
+			e.cache = NewCache(e.cacheSize, e.cache)
+		case `hashfile`:
+			if e.hashFile = value; value == `<empty>` {
+				e.hashFile = ``
+			}
+		case `savehashtofile`:
+			err := fmt.Errorf(`no search to save`)
+			if e.hashFile == `` {
+				err = fmt.Errorf(`no hash file given`)
+			} else if game != nil {
+				err = game.SaveCache(e.hashFile)
+			}
+			if err != nil {
+				e.reply("info string could not save hash: %v\n", err)
+			} else {
+				e.reply("info string hash saved to %s\n", e.hashFile)
+			}
+		case `loadhashfromfile`:
+			err := fmt.Errorf(`no hash file given`)
+			if e.hashFile != `` && game != nil {
+				err = game.LoadCache(e.hashFile)
+			} else if e.hashFile != `` {
+				_, err = e.LoadCache(e.hashFile)
+			}
+			if err != nil {
+				e.reply("info string could not load hash: %v\n", err)
+			} else {
+				e.reply("info string hash loaded from %s\n", e.hashFile)
+			}
+		case `threads`:
+			if n, ok := spin(1, MaxThreads); ok {
+				e.threads = n
+				game, position = nil, nil // Make sure the game gets restarted.
+			}
+		case `ponder`:
+			e.ponder = (value == `true`)
+		case `ownbook`:
+			e.ownBook = (value == `true`)
+		case `bookfile`:
+			if e.bookFile = value; value == `<empty>` {
+				e.bookFile = ``
+			}
+		case `bookpolicy`:
+			e.bookPolicy.set(value)
+		case `booktopmoves`:
+			if n, ok := spin(1, 32); ok {
+				e.bookPolicy.top = n
+			}
+		case `bookminweight`:
+			if n, ok := spin(0, 65535); ok {
+				e.bookPolicy.minWeight = n
+			}
+		case `bookdepth`:
+			if n, ok := spin(0, 255); ok {
+				e.bookDepth = n
+			}
+		case `booklearning`:
+			e.bookLearning = (value == `true`)
+		case `bookseed`:
+			if n, ok := spin(0, 2147483647); ok {
+				e.seedBook(int64(n))
+			}
+		case `multipv`:
+			if n, ok := spin(1, MaxMultiPV); ok {
+				e.multiPV = n
+			}
+		case `uci_limitstrength`:
+			e.limitStrength = (value == `true`)
+		case `uci_chess960`:
+			e.chess960 = (value == `true`)
+		case `uci_elo`:
+			if n, ok := spin(MinElo, MaxElo); ok {
+				e.elo = n
+			}
+		case `moveoverhead`:
+			if n, ok := spin(0, 5000); ok {
+				e.moveOverhead = int64(n)
+			}
+		case `mobility`, `pawnstructure`, `passedpawns`, `kingsafety`:
+			if n, ok := spin(0, 200); ok {
+				e.weigh(option, n)
+				game, position = nil, nil // Pawn cache holds weighted scores.
+			}
 		}
 	}
 
@@ -226,6 +475,7 @@ func (e *Engine) Uci() *Engine {
 		`position`:   doPosition,
 		`go`:         doGo,
 		`stop`:       doStop,
+		`ponderhit`:  doPonderHit,
 		`setoption`:  doSetOption,
 	}
 
@@ -241,8 +491,13 @@ func (e *Engine) Uci() *Engine {
 			//\\ e.debug("> " + command)
 			args := strings.Split(strings.Trim(command, " \t\r\n"), ` `)
 			if args[0] == `quit` {
+				doStop(nil)
 				break
 			}
+			if args[0] == `xboard` { // <-- Wrong number, switch to XBoard.
+				doStop(nil)
+				return e.xboard(bio)
+			}
 			if handler, ok := commands[args[0]]; ok {
 				handler(args[1:])
 			}
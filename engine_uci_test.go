@@ -0,0 +1,210 @@
+// Copyright (c) 2014-2018 by Michael Dvorkin. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+//
+// I am making my contributions/submissions to this project solely in my
+// personal capacity and am not conveying any rights to any intellectual
+// property of any third parties.
+
+package donna
+
+import(`github.com/michaeldv/donna/expect`; `bufio`; `fmt`; `os`; `strings`; `testing`; `time`)
+
+// Engine talking UCI or XBoard protocol: it reads the commands from one pipe
+// and replies to another one.
+type testSession struct {
+	t        *testing.T
+	commands *os.File
+	lines    chan string
+	done     chan bool
+}
+
+// Starts the protocol loop, ex. (*Engine).Uci, for the engine.
+func newTestSession(t *testing.T, engine *Engine, protocol func(*Engine) *Engine) *testSession {
+	input, commands, _ := os.Pipe()
+	replies, output, _ := os.Pipe()
+	stdin, stdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = input, output
+
+	session := &testSession{ t: t, commands: commands, lines: make(chan string, 1024), done: make(chan bool, 1) }
+	go func() {
+		protocol(engine)
+		output.Close()
+		session.done <- true
+	}()
+	go func() {
+		reader := bufio.NewReader(replies)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				close(session.lines)
+				return
+			}
+			session.lines <- strings.TrimSpace(line)
+		}
+	}()
+	t.Cleanup(func() {
+		session.quit()
+		os.Stdin, os.Stdout = stdin, stdout
+	})
+
+	return session
+}
+
+// Sends the commands to the engine.
+func (s *testSession) send(commands ...string) *testSession {
+	for _, command := range commands {
+		fmt.Fprintln(s.commands, command)
+	}
+	return s
+}
+
+// Skips the replies until the one that starts with any of the prefixes, and
+// returns it. Gives up after 5 seconds.
+func (s *testSession) reply(prefixes ...string) string {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line, ok := <-s.lines:
+			if !ok {
+				return `closed`
+			}
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(line, prefix) {
+					return line
+				}
+			}
+		case <-timeout:
+			return `timeout`
+		}
+	}
+}
+
+// Waits for UCI best move and returns it in coordinate notation.
+func (s *testSession) bestMove() string {
+	if reply := strings.Fields(s.reply(`bestmove`)); len(reply) > 1 {
+		return reply[1]
+	}
+	return `timeout`
+}
+
+// Quits the session and waits for the engine to finish.
+func (s *testSession) quit() {
+	select {
+	case <-s.done:
+	default:
+		s.send(`quit`)
+		<-s.done
+	}
+	s.done <- true // Quit only once.
+}
+
+// Search limits of "go infinite" do not carry over to the next search.
+func TestUci000(t *testing.T) {
+	uci := newTestSession(t, NewEngine(), (*Engine).Uci)
+	uci.send(`position fen 8/8/8/8/8/2q5/8/K1k5 w - - 0 1`) // Ka2 is the only move.
+	uci.send(`go infinite`, `stop`)
+	expect.Eq(t, uci.bestMove(), `a1a2`)
+
+	uci.send(`go`)
+	expect.Eq(t, uci.bestMove(), `a1a2`)
+}
+
+// Plain "go" after "go infinite" gets back to the engine's default move time.
+func TestUci010(t *testing.T) {
+	uci := newTestSession(t, NewEngine(`movetime`, 300), (*Engine).Uci)
+	uci.send(`position startpos`, `go infinite`, `stop`)
+	expect.Ne(t, uci.bestMove(), `timeout`)
+
+	start := time.Now()
+	uci.send(`go`)
+	expect.Ne(t, uci.bestMove(), `timeout`)
+	expect.True(t, time.Since(start) < 2 * time.Second)
+}
+
+// Pondering goes on until "ponderhit", and then the search is timed.
+func TestUci020(t *testing.T) {
+	uci := newTestSession(t, NewEngine(), (*Engine).Uci)
+	uci.send(`setoption name Ponder value true`, `position startpos moves e2e4 e7e5`)
+	uci.send(`go ponder wtime 1000 btime 1000`)
+	time.Sleep(300 * time.Millisecond)
+	uci.send(`isready`)
+	expect.Eq(t, uci.reply(`bestmove`, `readyok`), `readyok`) // Still pondering.
+
+	start := time.Now()
+	uci.send(`ponderhit`)
+	expect.Ne(t, uci.bestMove(), `timeout`)
+	expect.True(t, time.Since(start) < 2 * time.Second)
+}
+
+// Pondering that ends with "stop" reports the best move once.
+func TestUci030(t *testing.T) {
+	uci := newTestSession(t, NewEngine(), (*Engine).Uci)
+	uci.send(`setoption name Ponder value true`, `position startpos moves e2e4 e7e5`)
+	uci.send(`go ponder wtime 1000 btime 1000`)
+	time.Sleep(100 * time.Millisecond)
+	uci.send(`stop`)
+	expect.Ne(t, uci.bestMove(), `timeout`)
+	uci.send(`isready`)
+	expect.Eq(t, uci.reply(`bestmove`, `readyok`), `readyok`)
+}
+
+// Engine stays responsive while searching, and "stop" gets one best move.
+func TestUci040(t *testing.T) {
+	uci := newTestSession(t, NewEngine(), (*Engine).Uci)
+	uci.send(`position startpos`, `go infinite`, `isready`)
+	expect.Eq(t, uci.reply(`bestmove`, `readyok`), `readyok`)
+
+	uci.send(`stop`)
+	expect.Ne(t, uci.bestMove(), `timeout`)
+	uci.send(`isready`)
+	expect.Eq(t, uci.reply(`bestmove`, `readyok`), `readyok`)
+}
+
+// Option names and values might have several words.
+func TestUci050(t *testing.T) {
+	tests := []struct {
+		command string
+		setup   func(*Engine)
+		check   func(*Engine) bool
+	}{
+		{ `setoption name Clear Hash`,
+		  func(e *Engine) { e.cacheSize = 1; e.cache = NewCache(1, nil); e.cache[0][0].flags = cacheExact },
+		  func(e *Engine) bool { return len(e.cache) > 0 && e.cache[0][0].flags == cacheNone } },
+		{ `setoption name Book File value some file.bin`, nil,
+		  func(e *Engine) bool { return e.bookFile == `some file.bin` } },
+		{ `setoption name BookFile value <empty>`,
+		  func(e *Engine) { e.bookFile = `book.bin` },
+		  func(e *Engine) bool { return e.bookFile == `` } },
+		{ `setoption name Hash File value my analysis.tt`, nil,
+		  func(e *Engine) bool { return e.hashFile == `my analysis.tt` } },
+		{ `setoption name move overhead value 250`, nil,
+		  func(e *Engine) bool { return e.moveOverhead == 250 } },
+		{ `setoption name Pawn Structure value 50`, nil,
+		  func(e *Engine) bool { return e.weights.pawnStructure == NewEngine().weigh(`pawnstructure`, 50).weights.pawnStructure } },
+		{ `setoption name MultiPV value 3`, nil,
+		  func(e *Engine) bool { return e.multiPV == 3 } },
+		{ `setoption name MultiPV value 1000`, nil, // Out of range.
+		  func(e *Engine) bool { return e.multiPV == 1 } },
+		{ `setoption name MultiPV`, nil, // Missing value.
+		  func(e *Engine) bool { return e.multiPV == 1 } },
+		{ `setoption name MultiPV value`, nil,
+		  func(e *Engine) bool { return e.multiPV == 1 } },
+		{ `setoption name Contempt value 10`, nil, // Unknown option.
+		  func(e *Engine) bool { return e.multiPV == 1 && e.bookFile == `` && e.hashFile == `` } },
+		{ `setoption value 10`, nil, // Missing name.
+		  func(e *Engine) bool { return e.multiPV == 1 } },
+	}
+
+	for _, test := range tests {
+		engine := NewEngine()
+		if test.setup != nil {
+			test.setup(engine)
+		}
+		uci := newTestSession(t, engine, (*Engine).Uci)
+		uci.send(test.command, `isready`)
+		expect.Eq(t, uci.reply(`readyok`), `readyok`)
+		uci.quit()
+		expect.True(t, test.check(engine))
+	}
+}
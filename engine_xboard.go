@@ -0,0 +1,367 @@
+// Copyright (c) 2014-2018 by Michael Dvorkin. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+//
+// I am making my contributions/submissions to this project solely in my
+// personal capacity and am not conveying any rights to any intellectual
+// property of any third parties.
+
+package donna
+
+import (
+	`bufio`
+	`fmt`
+	`os`
+	`strconv`
+	`strings`
+)
+
+// Thinking output: ply, score in centipawns, time in centiseconds, nodes, and
+// principal variation. Mate scores are reported as 100000 + moves to mate.
+func (e *Engine) xboardPrincipal(game *Game, depth, score int, duration int64) *Engine {
+	if game.line > 0 || (!e.post && !e.options.infinite) {
+		return e
+	}
+
+	if !isMate(score) {
+		score = score * 100 / onePawn
+	} else if score > 0 {
+		score = 100000 + (Checkmate - score + 1) / 2
+	} else {
+		score = -100000 - (Checkmate + score) / 2
+	}
+
+	nodes, qnodes := game.totals()
+	str := fmt.Sprintf("%d %d %d %d", depth, score, duration / 10, nodes + qnodes)
+	for i := 0; i < game.rootpv.size; i++ {
+		str += " " + e.notation(game.rootpv.moves[i])
+	}
+
+	return e.reply(str + "\n")
+}
+
+// Returns result claim for the game that is over, or blank string otherwise.
+func xboardResult(position *Position) string {
+	switch position.Status() {
+	case WhiteWon:
+		return `1-0 {White mates}`
+	case BlackWon:
+		return `0-1 {Black mates}`
+	case Stalemate:
+		return `1/2-1/2 {Stalemate}`
+	case Insufficient:
+		return `1/2-1/2 {Insufficient material}`
+	case Repetition:
+		return `1/2-1/2 {Draw by repetition}`
+	case FiftyMoves:
+		return `1/2-1/2 {Draw by fifty move rule}`
+	}
+
+	return ``
+}
+
+// Chess Engine Communication Protocol (CECP) version 2 as spoken by XBoard and
+// WinBoard, see https://www.gnu.org/software/xboard/engine-intf.html
+func (e *Engine) Xboard() *Engine {
+	return e.xboard(bufio.NewReader(os.Stdin))
+}
+
+func (e *Engine) xboard(bio *bufio.Reader) *Engine {
+	var game *Game
+	var position *Position
+
+	e.uci, e.cecp = false, true
+
+	defaults := e.options          // Search limits when no time control is set.
+	color, force := Black, false   // Engine plays Black in a new game.
+	analyzing, searching, hint := false, false, Move(0)
+	maxDepth, moveTime := 0, int64(0)
+	movesPerSession, timeLeft, timeInc := int64(0), int64(0), int64(0)
+
+	// Commands are read in the background so that we could handle them and
+	// search results as they come.
+	commands, results := make(chan string), make(chan Result)
+	go func() {
+		for {
+			command, err := bio.ReadString('\n')
+			if err != nil && len(command) == 0 {
+				close(commands)
+				return
+			}
+			commands <- command
+		}
+	}()
+
+	newGame := func() {
+		game, e.chess960 = e.NewGame(), false
+		position = game.start()
+		color, force, hint = Black, false, Move(0)
+		maxDepth = 0
+	}
+
+	// Sets search limits for the next move based on XBoard time controls. The
+	// depth set by "sd" caps the search on top of the time control, if any.
+	limits := func() {
+		switch {
+		case analyzing:
+			e.fixedLimit(Options{ infinite: true })
+		case moveTime > 0:
+			e.fixedLimit(Options{ moveTime: moveTime })
+		case timeLeft > 0:
+			options := Options{ timeLeft: timeLeft, timeInc: timeInc }
+			if movesPerSession > 0 {
+				movesMade := int64(len(game.moves) / 2)
+				options.movesToGo = movesPerSession - movesMade % movesPerSession
+			}
+			e.varyingLimits(options)
+		case maxDepth > 0:
+			e.fixedLimit(Options{ maxDepth: maxDepth })
+		default:
+			e.fixedLimit(defaults)
+		}
+		if !analyzing && maxDepth > 0 {
+			e.options.maxDepth = maxDepth
+		}
+	}
+
+	// Claims the result if the game is over.
+	claim := func() bool {
+		if result := xboardResult(position); result != `` {
+			e.reply("%s\n", result)
+			return true
+		}
+		return false
+	}
+
+	// Searches current position in the background: it's either analysis or
+	// looking for the move to make.
+	think := func() {
+		if !analyzing && claim() {
+			return
+		}
+		limits()
+		e.clock.halt.Store(false)
+		searching = true
+		go func() {
+			results <- game.think()
+		}()
+	}
+
+	// Makes the move found by the search unless we're analyzing.
+	makeMove := func(result Result) {
+		searching = false
+		if !analyzing && result.Move != 0 {
+			e.reply("move %s\n", e.notation(result.Move))
+			position, hint = game.makeMove(result.Move), result.Ponder
+			claim()
+		}
+	}
+
+	// Waits for the search to finish before the game gets changed. The
+	// search result gets discarded if the search has to be abandoned.
+	finish := func(abandon bool) {
+		if searching {
+			if abandon || analyzing {
+				e.halt()
+			}
+			if result := <-results; abandon {
+				searching = false
+			} else {
+				makeMove(result)
+			}
+		}
+	}
+
+	// Resumes analysis after the position has changed.
+	reanalyze := func() {
+		if analyzing {
+			think()
+		}
+	}
+
+	undo := func(plies int) {
+		finish(true)
+		for ; plies > 0 && len(game.moves) > 0; plies-- {
+			position = game.undoLastMove()
+		}
+		hint = Move(0)
+		reanalyze()
+	}
+
+	userMove := func(notation string) {
+		finish(true)
+		move, _ := NewMoveFromString(position, notation)
+		if move == 0 {
+			e.reply("Illegal move: %s\n", notation)
+			reanalyze()
+			return
+		}
+		position, hint = game.makeMove(move), Move(0)
+		if analyzing {
+			reanalyze()
+		} else if !force && position.color == color {
+			think()
+		} else {
+			claim()
+		}
+	}
+
+	// Parses "level" time values given as minutes or minutes:seconds.
+	minutes := func(value string) int64 {
+		clock := strings.Split(value, `:`)
+		min, _ := strconv.Atoi(clock[0])
+		sec := 0
+		if len(clock) > 1 {
+			sec, _ = strconv.Atoi(clock[1])
+		}
+		return int64(min * 60 + sec) * 1000
+	}
+
+	newGame()
+
+	// Without further ado.
+	for {
+		var command string
+		select {
+		case result := <-results:
+			makeMove(result)
+			continue
+		case line, ok := <-commands:
+			if !ok {
+				finish(true)
+				return e
+			}
+			command = line
+		}
+
+		//\\ e.debug("> " + command)
+		args := strings.Fields(command)
+		if len(args) == 0 {
+			continue
+		}
+
+		switch args, command = args[1:], args[0]; command {
+		case `xboard`, `accepted`, `rejected`, `random`, `computer`, `name`, `rating`, `ics`,
+		     `hard`, `easy`, `otim`, `draw`, `white`, `black`, `.`:
+			// Nothing to do.
+		case `protover`:
+			e.reply("feature done=0\n")
+			e.reply("feature myname=\"Donna %s\" variants=\"normal,fischerandom\" setboard=1 usermove=1 ping=1 playother=1 analyze=1 colors=0\n", Version)
+			e.reply("feature sigint=0 sigterm=0 reuse=1 time=1 draw=0 memory=1 smp=1\n")
+			e.reply("feature done=1\n")
+		case `new`:
+			finish(true)
+			newGame()
+			reanalyze()
+		case `variant`:
+			// Chess960 positions come with "setboard" right after the
+			// variant, and castles go as O-O and O-O-O.
+			e.chess960 = len(args) > 0 && args[0] == `fischerandom`
+		case `force`:
+			finish(true)
+			force = true
+		case `go`:
+			finish(true)
+			color, force = position.color, false
+			think()
+		case `playother`:
+			finish(true)
+			color, force = position.color ^ 1, false
+		case `usermove`:
+			if len(args) > 0 {
+				userMove(args[0])
+			}
+		case `?`:
+			if searching && !analyzing {
+				e.halt() // Move now.
+			}
+		case `ping`:
+			if !analyzing {
+				finish(false) // Reply after making the move.
+			}
+			e.reply("pong %s\n", strings.Join(args, ` `))
+		case `level`:
+			if len(args) == 3 {
+				mps, _ := strconv.Atoi(args[0])
+				inc, _ := strconv.ParseFloat(args[2], 64)
+				movesPerSession, timeInc, moveTime = int64(mps), int64(inc * 1000), 0
+				timeLeft = minutes(args[1])
+			}
+		case `st`:
+			if len(args) > 0 {
+				if seconds, err := strconv.Atoi(args[0]); err == nil {
+					moveTime = int64(seconds) * 1000
+				}
+			}
+		case `sd`:
+			if len(args) > 0 {
+				maxDepth, _ = strconv.Atoi(args[0])
+			}
+		case `time`:
+			if len(args) > 0 {
+				if centiseconds, err := strconv.Atoi(args[0]); err == nil {
+					timeLeft = int64(centiseconds) * 10
+				}
+			}
+		case `undo`:
+			undo(1)
+		case `remove`:
+			undo(2)
+		case `setboard`:
+			finish(true)
+			initial := game.initial
+			game.initial = strings.Join(args, ` `)
+			if _, err := game.setup(); err != nil {
+				e.reply("tellusererror Illegal position: %v\n", err)
+				game.initial = initial
+			}
+			position, hint = game.start(), Move(0)
+			reanalyze()
+		case `post`:
+			e.post = true
+		case `nopost`:
+			e.post = false
+		case `analyze`:
+			finish(true)
+			analyzing = true
+			think()
+		case `exit`:
+			finish(true)
+			analyzing = false
+		case `hint`:
+			if hint != 0 && !searching {
+				e.reply("Hint: %s\n", e.notation(hint))
+			}
+		case `result`:
+			finish(true)
+			force = true
+			if len(args) > 0 {
+				game.learnOutcome(args[0])
+			}
+		case `memory`:
+			if len(args) > 0 {
+				if n, err := strconv.Atoi(args[0]); err == nil && n > 0 {
+					e.cacheSize = float64(n) // Takes effect in a new game.
+				}
+			}
+		case `cores`:
+			if len(args) > 0 {
+				if n, err := strconv.Atoi(args[0]); err == nil {
+					e.threads = max(1, min(n, MaxThreads)) // Takes effect in a new game.
+				}
+			}
+		case `quit`:
+			finish(true)
+			return e
+		default:
+			// Accept moves without "usermove" prefix from older interfaces.
+			if !searching {
+				if move, _ := NewMoveFromString(position, command); move != 0 {
+					userMove(command)
+					continue
+				}
+			}
+			e.reply("Error (unknown command): %s\n", command)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2014-2018 by Michael Dvorkin. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+//
+// I am making my contributions/submissions to this project solely in my
+// personal capacity and am not conveying any rights to any intellectual
+// property of any third parties.
+
+package donna
+
+import(`github.com/michaeldv/donna/expect`; `testing`; `time`)
+
+// Engine plays Black in a new game and replies to the user's move.
+func TestXboard000(t *testing.T) {
+	xboard := newTestSession(t, NewEngine(), (*Engine).Xboard)
+	xboard.send(`xboard`, `protover 2`)
+	expect.Eq(t, xboard.reply(`feature done=1`), `feature done=1`)
+
+	xboard.send(`new`, `sd 2`, `usermove e2e4`)
+	expect.Contain(t, xboard.reply(`move `, `Illegal`), `move `)
+	xboard.send(`ping 1`)
+	expect.Eq(t, xboard.reply(`pong`), `pong 1`)
+}
+
+// Force mode, taking moves back, and making the engine move with "go".
+func TestXboard010(t *testing.T) {
+	xboard := newTestSession(t, NewEngine(`depth`, 2), (*Engine).Xboard)
+	xboard.send(`new`, `force`, `setboard 8/8/8/8/8/2q5/8/K1k5 w - - 0 1`) // Ka2 is the only move.
+	xboard.send(`usermove a1a2`, `usermove c3c2`, `ping 1`)
+	expect.Eq(t, xboard.reply(`pong`, `move `), `pong 1`) // No moves in force mode.
+
+	xboard.send(`undo`, `undo`, `undo`, `go`)
+	expect.Eq(t, xboard.reply(`move `, `Illegal`), `move a1a2`)
+}
+
+// Depth set by "sd" does not override the clock.
+func TestXboard020(t *testing.T) {
+	xboard := newTestSession(t, NewEngine(), (*Engine).Xboard)
+	xboard.send(`new`, `level 40 0:02 0`, `sd 30`, `time 200`, `otim 200`)
+
+	start := time.Now()
+	xboard.send(`usermove e2e4`)
+	expect.Contain(t, xboard.reply(`move `), `move `)
+	expect.True(t, time.Since(start) < 2 * time.Second)
+
+	// Same with fixed time per move.
+	xboard.send(`st 1`)
+	start = time.Now()
+	xboard.send(`usermove d2d4`)
+	expect.Contain(t, xboard.reply(`move `), `move `)
+	expect.True(t, time.Since(start) < 2 * time.Second)
+}
+
+// Moves to go till time control are counted from the position set up by the
+// "setboard".
+func TestXboard030(t *testing.T) {
+	engine := NewEngine()
+	xboard := newTestSession(t, engine, (*Engine).Xboard)
+	xboard.send(`new`, `force`, `setboard r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3`)
+	xboard.send(`level 40 5 0`, `time 1000`, `otim 1000`)
+	xboard.send(`usermove f1c4`, `usermove g8f6`, `go`)
+	expect.Contain(t, xboard.reply(`move `), `move `)
+	xboard.quit()
+	expect.Eq(t, engine.options.movesToGo, int64(39))
+}
@@ -0,0 +1,225 @@
+// Copyright (c) 2014-2018 by Michael Dvorkin. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+//
+// I am making my contributions/submissions to this project solely in my
+// personal capacity and am not conveying any rights to any intellectual
+// property of any third parties.
+
+package donna
+
+import (
+	`bytes`
+	`fmt`
+	`strconv`
+	`strings`
+)
+
+// EPD operation: opcode followed by zero or more operands, ex. `bm Qd1+ Qd2`,
+// `dm 3`, or `id "WAC.001"`.
+type EpdOperation struct {
+	opcode    string
+	operands  []string
+}
+
+// Extended Position Description: first four FEN fields (pieces, side to move,
+// castle rights, and en-passant square) followed by the operations.
+type Epd struct {
+	position    string           // First four FEN fields.
+	operations  []EpdOperation   // Operations in the order of appearance.
+}
+
+// Allowed difference between the search score and "ce" target, in centipawns.
+const epdMargin = 50
+
+// Decodes EPD record. The operations are separated by semicolons, and string
+// operands could be double quoted.
+func NewEpd(line string) (*Epd, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 {
+		return nil, fmt.Errorf(`invalid EPD position: %s`, line)
+	}
+
+	epd := &Epd{ position: strings.Join(fields[0:4], ` `) }
+
+	// Tolerate full FEN: half-move clock and full move number then become
+	// "hmvc" and "fmvn" operations.
+	skip := 4
+	if len(fields) >= 6 {
+		_, err1 := strconv.Atoi(fields[4])
+		_, err2 := strconv.Atoi(fields[5])
+		if err1 == nil && err2 == nil {
+			epd.Set(`hmvc`, fields[4]).Set(`fmvn`, fields[5])
+			skip = 6
+		}
+	}
+
+	// Skip the position fields and parse the rest character by character.
+	rest := strings.TrimSpace(line)
+	for i := 0; i < skip; i++ {
+		rest = strings.TrimSpace(rest[len(fields[i]):])
+	}
+
+	var operation *EpdOperation
+	for i := 0; i < len(rest); i++ {
+		switch char := rest[i]; char {
+		case ' ', '\t', '\r', '\n':
+		case ';':
+			operation = nil
+		case '"':
+			end := strings.IndexByte(rest[i + 1:], '"')
+			if end < 0 || operation == nil {
+				return nil, fmt.Errorf(`invalid EPD string operand: %s`, rest[i:])
+			}
+			operation.operands = append(operation.operands, rest[i + 1:i + 1 + end])
+			i += end + 1
+		default:
+			start := i
+			for i < len(rest) && strings.IndexByte(" \t\r\n;", rest[i]) < 0 {
+				i++
+			}
+			token := rest[start:i]
+			i--
+			if operation == nil {
+				epd.operations = append(epd.operations, EpdOperation{ opcode: token })
+				operation = &epd.operations[len(epd.operations) - 1]
+			} else {
+				operation.operands = append(operation.operands, token)
+			}
+		}
+	}
+
+	return epd, nil
+}
+
+// Returns new EPD record for the position without any operations.
+func NewEpdFromPosition(p *Position) *Epd {
+	return &Epd{ position: strings.Join(strings.Fields(p.fen())[0:4], ` `) }
+}
+
+// Returns FEN string for the EPD position. Half-move clock and full move
+// number are taken from "hmvc" and "fmvn" operations if present.
+func (epd *Epd) Fen() string {
+	hmvc, fmvn := epd.operand(`hmvc`), epd.operand(`fmvn`)
+	if hmvc == `` {
+		hmvc = `0`
+	}
+	if fmvn == `` {
+		fmvn = `1`
+	}
+
+	return epd.position + ` ` + hmvc + ` ` + fmvn
+}
+
+// Returns operands of the given operation, or nil if the operation is missing.
+func (epd *Epd) Operands(opcode string) []string {
+	for _, operation := range epd.operations {
+		if operation.opcode == opcode {
+			return operation.operands
+		}
+	}
+
+	return nil
+}
+
+// Returns first operand of the given operation or blank string.
+func (epd *Epd) operand(opcode string) string {
+	if operands := epd.Operands(opcode); len(operands) > 0 {
+		return operands[0]
+	}
+
+	return ``
+}
+
+// Adds the operation or replaces its operands if the operation is already
+// there.
+func (epd *Epd) Set(opcode string, operands ...string) *Epd {
+	for i := range epd.operations {
+		if epd.operations[i].opcode == opcode {
+			epd.operations[i].operands = operands
+			return epd
+		}
+	}
+	epd.operations = append(epd.operations, EpdOperation{ opcode, operands })
+
+	return epd
+}
+
+// Encodes EPD record. Operands of string operations (id, comments) and the ones
+// with white space get double quoted.
+func (epd *Epd) String() string {
+	var buffer bytes.Buffer
+
+	buffer.WriteString(epd.position)
+	for _, operation := range epd.operations {
+		buffer.WriteString(` ` + operation.opcode)
+		quote := operation.opcode == `id` || (len(operation.opcode) == 2 && operation.opcode[0] == 'c' && operation.opcode[1] >= '0' && operation.opcode[1] <= '9')
+		for _, operand := range operation.operands {
+			if quote || strings.ContainsAny(operand, " \t;") {
+				buffer.WriteString(` "` + operand + `"`)
+			} else {
+				buffer.WriteString(` ` + operand)
+			}
+		}
+		buffer.WriteByte(';')
+	}
+
+	return buffer.String()
+}
+
+// Decodes the moves of "bm" or "am" operation in SAN or long algebraic
+// notation.
+func (epd *Epd) moves(p *Position, opcode string) (moves []Move) {
+	for _, operand := range epd.Operands(opcode) {
+		if move, _ := NewMoveFromString(p, operand); move.some() {
+			moves = append(moves, move)
+		}
+	}
+
+	return moves
+}
+
+// Returns true if the search result meets all EPD targets: best moves (bm),
+// avoid moves (am), direct mate (dm), and centipawn evaluation (ce).
+func (epd *Epd) solved(p *Position, result Result) bool {
+	found := func(moves []Move) bool {
+		for _, move := range moves {
+			if move == result.Move {
+				return true
+			}
+		}
+		return false
+	}
+
+	if bm := epd.moves(p, `bm`); len(bm) > 0 && !found(bm) {
+		return false
+	}
+	if am := epd.moves(p, `am`); len(am) > 0 && found(am) {
+		return false
+	}
+	if dm := epd.operand(`dm`); dm != `` {
+		if moves, err := strconv.Atoi(dm); err != nil || result.Mate <= 0 || result.Mate > moves {
+			return false
+		}
+	}
+	if ce := epd.operand(`ce`); ce != `` {
+		if score, err := strconv.Atoi(ce); err != nil || result.Mate != 0 || abs(result.Score - score) > epdMargin {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns short description of the EPD targets, ex. `bm Qd1+; dm 3`.
+func (epd *Epd) targets() string {
+	var list []string
+
+	for _, opcode := range []string{ `bm`, `am`, `dm`, `ce` } {
+		if operands := epd.Operands(opcode); len(operands) > 0 {
+			list = append(list, opcode + ` ` + strings.Join(operands, ` `))
+		}
+	}
+
+	return strings.Join(list, `; `)
+}
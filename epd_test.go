@@ -0,0 +1,69 @@
+// Copyright (c) 2014-2018 by Michael Dvorkin. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+//
+// I am making my contributions/submissions to this project solely in my
+// personal capacity and am not conveying any rights to any intellectual
+// property of any third parties.
+
+package donna
+
+import(`github.com/michaeldv/donna/expect`; `testing`)
+
+// Operations with quoted strings and multiple operands.
+func TestEpd000(t *testing.T) {
+	epd, err := NewEpd(`2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 w - - bm Qg6 Qh3; id "WAC.001"; c0 "Fred Reinfeld; 1958";`)
+	expect.Eq(t, err, nil)
+	expect.Eq(t, epd.Operands(`bm`), []string{ `Qg6`, `Qh3` })
+	expect.Eq(t, epd.operand(`id`), `WAC.001`)
+	expect.Eq(t, epd.operand(`c0`), `Fred Reinfeld; 1958`)
+	expect.Eq(t, epd.Operands(`am`), []string(nil))
+	expect.Eq(t, epd.Fen(), `2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 w - - 0 1`)
+	expect.Eq(t, epd.String(), `2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 w - - bm Qg6 Qh3; id "WAC.001"; c0 "Fred Reinfeld; 1958";`)
+
+	_, err = NewEpd(`8/8/8 w`)
+	expect.Ne(t, err, nil)
+	_, err = NewEpd(`8/8/8/8/8/8/8/8 w - - id "WAC.001;`)
+	expect.Ne(t, err, nil)
+}
+
+// Full FEN lines and EPD records built from position.
+func TestEpd010(t *testing.T) {
+	epd, _ := NewEpd(`rnbqkb1r/1p3ppp/p2ppn2/8/3NP3/2N1BP2/PPP3PP/R2QKB1R b KQkq - 0 7`)
+	expect.Eq(t, epd.Fen(), `rnbqkb1r/1p3ppp/p2ppn2/8/3NP3/2N1BP2/PPP3PP/R2QKB1R b KQkq - 0 7`)
+
+	epd = NewEpdFromPosition(NewGame().start()).Set(`dm`, `3`).Set(`id`, `start`).Set(`dm`, `2`)
+	expect.Eq(t, epd.String(), `rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - dm 2; id "start";`)
+}
+
+// Scoring search results against bm, am, dm, and ce targets.
+func TestEpd020(t *testing.T) {
+	p := NewGame().start()
+	e4, d4 := NewPawnMove(p, E2, E4), NewPawnMove(p, D2, D4)
+
+	epd, _ := NewEpd(`rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - bm e4 Nf3;`)
+	expect.True(t, epd.solved(p, Result{ Move: e4 }))
+	expect.False(t, epd.solved(p, Result{ Move: d4 }))
+
+	epd, _ = NewEpd(`rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - am e2e4;`)
+	expect.False(t, epd.solved(p, Result{ Move: e4 }))
+	expect.True(t, epd.solved(p, Result{ Move: d4 }))
+
+	epd, _ = NewEpd(`rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - dm 3;`)
+	expect.True(t, epd.solved(p, Result{ Move: e4, Mate: 2 }))
+	expect.False(t, epd.solved(p, Result{ Move: e4, Mate: 4 }))
+	expect.False(t, epd.solved(p, Result{ Move: e4, Mate: -3 }))
+
+	epd, _ = NewEpd(`rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - ce 30;`)
+	expect.True(t, epd.solved(p, Result{ Move: e4, Score: 60 }))
+	expect.False(t, epd.solved(p, Result{ Move: e4, Score: -30 }))
+}
+
+// Solving the position with the search.
+func TestEpd030(t *testing.T) {
+	epd, _ := NewEpd(`2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 w - - bm Qg6; id "WAC.001";`)
+	engine := NewEngine(`depth`, 7)
+	game := engine.NewGame(epd.Fen())
+	position := game.start()
+	expect.True(t, epd.solved(position, game.Search()))
+}
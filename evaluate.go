@@ -51,28 +51,25 @@ type Evaluation struct {
 	safety    [2]Safety 	 // King safety data for both sides.
 	attacks   [14]Bitmask 	 // Attack bitmasks for all the pieces on the board.
 	pins      [2]Bitmask     // Bitmask of pinned pieces for both sides.
+	weights   *Weights 	 // Pointer to the engine's evaluation weights.
 	pawns     *PawnEntry 	 // Pointer to the pawn cache entry.
 	material  *MaterialEntry // Pointer to the matrial base entry.
 	position  *Position 	 // Pointer to the position we're evaluating.
 	metrics   Metrics 	 // Evaluation metrics when tracking is on.
 }
 
-// Use single statically allocated variable to avoid garbage collection overhead.
-var eval Evaluation
-
 // The following statement is true. The previous statement is false. Main position
 // evaluation method that returns single blended score.
 func (p *Position) Evaluate() int {
-	return eval.init(p).run()
+	return p.thread.eval.init(p).run()
 }
 
 // Auxiliary evaluation method that captures individual evaluation metrics. This
 // is useful when we want to see evaluation summary.
 func (p *Position) EvaluateWithTrace() (int, Metrics) {
-	eval.init(p)
+	eval := p.thread.eval.init(p)
 	eval.metrics = make(Metrics)
 
-	engine.trace = true
 	defer func() {
 		var tempo Total
 		var final Score
@@ -90,15 +87,15 @@ func (p *Position) EvaluateWithTrace() (int, Metrics) {
 		eval.checkpoint(`PST`, p.tally)
 		eval.checkpoint(`Tempo`, tempo)
 		eval.checkpoint(`Final`, final)
-		engine.trace = false
 	}()
 
 	return eval.run(), eval.metrics
 }
 
 func (e *Evaluation) init(p *Position) *Evaluation {
-	eval = Evaluation{}
+	*e = Evaluation{}
 	e.position = p
+	e.weights = &p.thread.game.engine.weights
 
 	// Initialize the score with incremental PST value and right to move.
 	e.score = p.tally
@@ -158,6 +155,11 @@ func (e *Evaluation) wrapUp() {
 	}
 }
 
+// Returns true if evaluation metrics are being captured.
+func (e *Evaluation) tracing() bool {
+	return e.metrics != nil
+}
+
 func (e *Evaluation) checkpoint(tag string, metric interface{}) {
 	e.metrics[tag] = metric
 }
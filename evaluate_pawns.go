@@ -22,20 +22,21 @@ func (e *Evaluation) analyzePawns() {
 	key := e.position.pawnId
 
 	// Since pawn hash is fairly small we can use much faster 32-bit index.
-	index := uint32(key) % uint32(len(game.pawnCache))
-	e.pawns = &game.pawnCache[index]
+	pawnCache := &e.position.thread.pawnCache
+	index := uint32(key) % uint32(len(pawnCache))
+	e.pawns = &pawnCache[index]
 
 	// Bypass pawns cache if evaluation tracing is enabled.
-	if e.pawns.id != key || engine.trace {
+	if e.pawns.id != key || e.tracing() {
 		white, black := e.pawnStructure(White), e.pawnStructure(Black)
-		e.pawns.score.clear().add(white).sub(black).apply(weightPawnStructure)
+		e.pawns.score.clear().add(white).sub(black).apply(e.weights.pawnStructure)
 		e.pawns.id = key
 
 		// Force full king shelter evaluation since any legit king square
 		// will be viewed as if the king has moved.
 		e.pawns.king[White], e.pawns.king[Black] = 0xFF, 0xFF
 
-		if engine.trace {
+		if e.tracing() {
 			e.checkpoint(`Pawns`, Total{white, black})
 		}
 	}
@@ -46,14 +47,14 @@ func (e *Evaluation) analyzePawns() {
 func (e *Evaluation) analyzePassers() {
 	var white, black, score Score
 
-	if engine.trace {
+	if e.tracing() {
 		defer func() {
 			e.checkpoint(`Passers`, Total{white, black})
 		}()
 	}
 
 	white, black = e.pawnPassers(White), e.pawnPassers(Black)
-	score.add(white).sub(black).apply(weightPassedPawns)
+	score.add(white).sub(black).apply(e.weights.passedPawns)
 	e.score.add(score)
 }
 
@@ -13,7 +13,7 @@ func (e *Evaluation) analyzePieces() {
 	var bonus, score Score
 	var knight, bishop, rook, queen, mobility Total
 
-	if engine.trace {
+	if e.tracing() {
 		defer func() {
 			var our, their Score
 			e.checkpoint(`Mobility`, mobility)
@@ -104,7 +104,7 @@ func (e *Evaluation) analyzePieces() {
 	e.attacks[Black] |= e.attacks[BlackKnight] | e.attacks[BlackBishop] | e.attacks[BlackRook] | e.attacks[BlackQueen]
 
 	// Calculate total mobility score applying mobility weight.
-	score.add(mobility.white).sub(mobility.black).apply(weightMobility)
+	score.add(mobility.white).sub(mobility.black).apply(e.weights.mobility)
 	e.score.add(score)
 }
 
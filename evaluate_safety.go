@@ -12,7 +12,7 @@ func (e *Evaluation) analyzeSafety() {
 	var score Score
 	var cover, safety Total
 
-	if engine.trace {
+	if e.tracing() {
 		defer func() {
 			var our, their Score
 			e.checkpoint(`+King`, Total{*our.add(cover.white).add(safety.white), *their.add(cover.black).add(safety.black)})
@@ -44,7 +44,7 @@ func (e *Evaluation) analyzeSafety() {
 	}
 
 	// Calculate total king safety and pawn cover score.
-	score.add(safety.white).sub(safety.black).apply(weightSafety)
+	score.add(safety.white).sub(safety.black).apply(e.weights.safety)
 	score.add(cover.white).sub(cover.black)
 	e.score.add(score)
 }
@@ -68,24 +68,24 @@ func TestEvaluate060(t *testing.T) {
 // Opposite-colored bishops.
 func TestEvaluate070(t *testing.T) {
 	p := NewGame(`Ke1,Bc1`, `Ke8,Bc8`).start()
-	eval.init(p)
+	eval := p.thread.eval.init(p)
 	expect.True(t, eval.oppositeBishops())
 }
 
 func TestEvaluate071(t *testing.T) {
 	p := NewGame(`Kc4,Bd4`, `Ke8,Bd5`).start()
-	eval.init(p)
+	eval := p.thread.eval.init(p)
 	expect.True(t, eval.oppositeBishops())
 }
 
 func TestEvaluate072(t *testing.T) {
 	p := NewGame(`Kc4,Bd4`, `Ke8,Be5`).start()
-	eval.init(p)
+	eval := p.thread.eval.init(p)
 	expect.False(t, eval.oppositeBishops())
 }
 
 func TestEvaluate073(t *testing.T) {
 	p := NewGame(`Ke1,Bc1`, `Ke8,Bf8`).start()
-	eval.init(p)
+	eval := p.thread.eval.init(p)
 	expect.False(t, eval.oppositeBishops())
 }
@@ -12,7 +12,7 @@ func (e *Evaluation) analyzeThreats() {
 	var score Score
 	var threats, center Total
 
-	if engine.trace {
+	if e.tracing() {
 		defer func() {
 			e.checkpoint(`Threats`, threats)
 			e.checkpoint(`Center`, center)
@@ -10,7 +10,9 @@ package donna
 
 import (
 	`fmt`
+	`sort`
 	`strings`
+	`sync`
 	`time`
 )
 
@@ -19,52 +21,114 @@ type RootPv struct {
 	moves [MaxPly]Move
 }
 type Pv [MaxPly]RootPv
+
+// One of the principal variations in MultiPV search along with its score.
+type Line struct {
+	score int
+	pv    RootPv
+}
+
 type History [14][64]int
 type Killers [MaxPly][2]Move
 
+// Search results as returned by Game.Search().
+type Result struct {
+	Move        Move 	// Best move found.
+	Ponder      Move 	// Expected reply to the best move, if any.
+	Score       int 	// Score in centipawns, positive when side to move is better.
+	Mate        int 	// Moves to checkmate: positive when mating, negative when getting mated.
+	Pv          []Move 	// Principal variation starting with the best move.
+	Depth       int 	// Depth of the last search iteration.
+	Nodes       int 	// Number of nodes searched by all threads.
+}
+
 type Game struct {
-	nodes       int 	// Number of regular nodes searched.
-	qnodes      int 	// Number of quiescence nodes searched.
+	engine      *Engine 	// Engine that plays the game.
+	quiet       bool 	// Suppress search output.
 	token       uint8 	// Cache's expiration token.
 	deepening   bool 	// True when searching first root move.
 	improving   bool 	// True when root search score is not falling.
 	volatility  float32 	// Root search stability count.
 	initial     string   	// Initial position (FEN or algebraic).
-	history     History  	// Good moves history.
-	killers     Killers  	// Killer moves.
+	castling    Castling 	// Home squares of kings and castling rooks.
 	rootpv      RootPv 	// Principal variation for root moves.
-	pv          Pv  	// Principal variations for each ply.
-	cache       Cache 	// Transposition table.
-	pawnCache   PawnCache 	// Cache of pawn structures.
+	line        int 	// MultiPV line being searched.
+	lines       []Line 	// MultiPV lines, best one first.
+	cache       Cache 	// Transposition table shared by all threads.
+	threads     []*Thread 	// Search threads; threads[0] is the main one.
+	helpers     sync.WaitGroup // Helper threads that are still searching.
+	started     time.Time 	// When the search has started.
+	reported    int64 	// When search progress was last reported, in milliseconds.
+	moves       []Move 	// Moves made since the initial position.
+	tags        []PgnTag 	// PGN tag pairs of the game loaded from PGN file.
+	bookMisses  int 	// Number of positions in a row not found in the book.
+	bookScored  bool 	// True once the engine has learned from the first search out of the book.
+	bookLine    []bookPlayed // Book moves played by the engine to learn from.
 }
 
-// Use single statically allocated variable.
-var game Game
-
 // We have two ways to initialize the game: 1) pass FEN string, and 2) specify
 // white and black pieces using regular chess notation.
 //
 // In latter case we need to tell who gets to move first when starting the game.
 // The second option is a bit less pricise (ex. no en-passant square) but it is
 // much more useful when writing tests from memory.
+//
+// The game gets played by its own engine with default settings. Use the
+// engine's NewGame() to play with the engine of your choice.
 func NewGame(args ...string) *Game {
-	game = Game{ cache: NewCache(engine.cacheSize), pawnCache: PawnCache{} }
+	return NewEngine().NewGame(args...)
+}
+
+// Starts new game played by the engine. The engine's cache gets reused (and
+// cleared) by each new game unless it has just been loaded from file.
+func (e *Engine) NewGame(args ...string) *Game {
+	if !e.keepCache {
+		e.cache = NewCache(e.cacheSize, e.cache)
+	}
+	game := &Game{ engine: e, cache: e.cache, token: e.cacheToken, castling: standardCastling }
+	e.keepCache, e.cacheToken = false, 0
+	game.threads = make([]*Thread, max(1, e.threads))
+	for i := range game.threads {
+		game.threads[i] = NewThread(game, i)
+	}
 
 	switch len(args) {
 	case 0: // Initial position.
-		game.initial = `rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1`
+		game.initial = initialFen
 	case 1: // Genuine FEN.
 		game.initial = args[0]
 	case 2: // Donna chess format (white and black).
 		game.initial = args[0] + ` : ` + args[1]
 	}
 
-	return &game
+	return game
 }
 
 func (game *Game) start() *Position {
-	engine.clock.halt = false
-	tree, node, rootNode = [1024]Position{}, 0, 0
+	position, _ := game.parse()
+	return position
+}
+
+// Sets up initial position of the game the same way start() does, and makes
+// sure the position is legal. Returns an error if the position given in FEN or
+// Donna Chess Format is invalid.
+func (game *Game) setup() (*Position, error) {
+	position, err := game.parse()
+	if err == nil {
+		err = position.validate()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return position, nil
+}
+
+// Resets the game and decodes its initial position.
+func (game *Game) parse() (*Position, error) {
+	game.engine.clock.halt.Store(false)
+	game.threads[0].node, game.threads[0].rootNode = 0, 0
+	game.moves = nil
 
 	// Was the game started with FEN or algebraic notation?
 	sides := strings.Split(game.initial, ` : `)
@@ -75,145 +139,342 @@ func (game *Game) start() *Position {
 }
 
 func (game *Game) position() *Position {
-	return &tree[node]
+	return game.threads[0].position()
+}
+
+// Makes the move in current position and records it in the game's move list.
+func (game *Game) makeMove(move Move) *Position {
+	game.moves = append(game.moves, move)
+	return game.position().makeMove(move)
 }
 
-// Resets principal variation as well as killer moves and move history. Cache
-// entries get expired by incrementing cache token. Root node gets set to the
-// current tree node to match the position.
+// Takes back the last move made in the game.
+func (game *Game) undoLastMove() *Position {
+	if size := len(game.moves); size > 0 {
+		game.moves = game.moves[:size - 1]
+	}
+	return game.position().undoLastMove()
+}
+
+// Sets up initial position of the game and returns it.
+func (game *Game) Start() *Position {
+	return game.start()
+}
+
+// Returns current position of the game.
+func (game *Game) Position() *Position {
+	return game.position()
+}
+
+// Resets principal variation as well as search state of all the threads. Cache
+// entries get expired by incrementing cache token.
 func (game *Game) getReady() *Game {
 	game.rootpv = RootPv{}
-	game.pv = Pv{}
-	game.killers = Killers{}
-	game.history = History{}
 	game.deepening = false
 	game.improving = true
 	game.volatility = 0.0
 	game.token += 4 // <-- Wraps around: ...248, 252, 0, 4... reserving last 2 bits.
 
-	rootNode = node
+	for _, thread := range game.threads {
+		thread.getReady()
+	}
+
 	return game
 }
 
-// Copies the very latest top principal variation line.
-func updateRootPv() {
-	if game.pv[0].size > 0 {
-		copy(game.rootpv.moves[0:], game.pv[0].moves[0:])
-		game.rootpv.size = game.pv[0].size
+// Returns the number of regular and quiescence nodes searched by all threads.
+func (game *Game) totals() (nodes, qnodes int) {
+	for _, thread := range game.threads {
+		nodes += thread.nodes
+		qnodes += thread.qnodes
 	}
+
+	return nodes, qnodes
 }
 
-// "The question of whether machines can think is about as relevant as the
-// question of whether submarines can swim." -- Edsger W. Dijkstra
-func (game *Game) Think() Move {
-	start := time.Now()
-	position := game.position()
-	game.nodes, game.qnodes = 0, 0
+// Sets helper threads off to search the main thread's root position. Node
+// limited searches are meant to be reproducible so they go single-threaded.
+func (game *Game) startHelpers() *Game {
+	if game.engine.fixedNodes() {
+		return game
+	}
 
-	if len(engine.bookFile) != 0 {
-		if book, err := NewBook(engine.bookFile); err == nil {
-			if move := book.pickMove(position); move != 0 {
-				game.printBestMove(move, since(start))
-				return move
-			}
-		} else if !engine.uci {
-			fmt.Printf("Book error: %v\n", err)
-		}
+	for _, thread := range game.threads[1:] {
+		thread.copyTree(game.threads[0]).getReady()
+		game.helpers.Add(1)
+		go func(thread *Thread) {
+			defer game.helpers.Done()
+			thread.assist()
+		}(thread)
 	}
 
-	game.getReady()
-	score, move, status, alpha, beta := 0, Move(0), InProgress, -Checkmate, Checkmate
+	return game
+}
 
-	if !engine.uci {
-		fmt.Println(ansiWhite + `Depth   Time     Nodes    QNodes   Nodes/s   Cache    Score   Best` + ansiNone)
+// Halts helper threads and waits for them to finish.
+func (game *Game) stopHelpers() *Game {
+	if len(game.threads) > 1 {
+		game.engine.clock.halt.Store(true)
+		game.helpers.Wait()
 	}
 
-	if !engine.fixedDepth() {
-		engine.startClock(); defer engine.stopClock();
+	return game
+}
+
+// Copies the very latest top principal variation line to the MultiPV line
+// being searched. The first line is also the root principal variation.
+func (game *Game) updateRootPv() {
+	if pv := &game.threads[0].pv; pv[0].size > 0 {
+		line := &game.lines[game.line].pv
+		copy(line.moves[0:], pv[0].moves[0:pv[0].size])
+		line.size = pv[0].size
+		if game.line == 0 {
+			game.rootpv = *line
+		}
 	}
+}
 
-	for depth := 1; game.keepThinking(depth, status, move); depth++ {
-		// Save previous best score in case search gets interrupted.
-		bestScore := score
+// Returns the moves to search in the root position: all legal moves unless
+// they were restricted by "go searchmoves".
+func (game *Game) rootMoves(position *Position) []Move {
+	if moves := game.engine.options.searchMoves; len(moves) > 0 {
+		return moves
+	}
 
-		// Assume volatility decreases with each new iteration.
-		game.volatility /= 2.0
+	return position.LegalMoves()
+}
 
-		// At low depths do the search with full alpha/beta spread.
-		// Aspiration window searches kick in at depth 5 and up.
-		if depth < 5 {
+// Sorts MultiPV lines by score since a line might end up scoring better than
+// the preceding ones. The best line becomes root principal variation.
+func (game *Game) rankLines() *Game {
+	sort.SliceStable(game.lines, func(i, j int) bool {
+		return game.lines[i].score > game.lines[j].score
+	})
+	if game.lines[0].pv.size > 0 {
+		game.rootpv = game.lines[0].pv
+	}
+
+	return game
+}
+
+// Returns true if the root move has been picked by one of the MultiPV lines
+// preceding the one being searched.
+func (game *Game) excluded(move Move) bool {
+	for i := 0; i < game.line; i++ {
+		if game.lines[i].pv.moves[0] == move {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Searches the root position with aspiration window around the score of the
+// previous iteration. Returns previous score if the search gets interrupted.
+func (game *Game) aspirate(position *Position, depth, score int) int {
+	alpha, beta := -Checkmate, Checkmate
+
+	// Save previous best score in case search gets interrupted.
+	bestScore := score
+
+	// At low depths do the search with full alpha/beta spread.
+	// Aspiration window searches kick in at depth 5 and up.
+	if depth < 5 {
+		score = position.search(alpha, beta, depth)
+		if score > alpha || depth == 1 {
+			bestScore = score
+			game.updateRootPv()
+		}
+	} else {
+		aspiration := onePawn / 3
+		alpha = max(score - aspiration, -Checkmate)
+		beta = min(score + aspiration, Checkmate)
+
+		// Do the search with smaller alpha/beta spread based on
+		// previous iteration score, and re-search with the bigger
+		// window as necessary.
+		for {
 			score = position.search(alpha, beta, depth)
-			if score > alpha || depth == 1 {
+			if score > alpha {
 				bestScore = score
-				updateRootPv()
+				game.updateRootPv()
 			}
-		} else {
-			aspiration := onePawn / 3
-			alpha = max(score - aspiration, -Checkmate)
-			beta = min(score + aspiration, Checkmate)
-
-			// Do the search with smaller alpha/beta spread based on
-			// previous iteration score, and re-search with the bigger
-			// window as necessary.
-			for {
-				score = position.search(alpha, beta, depth)
-				if score > alpha {
-					bestScore = score
-					updateRootPv()
-				}
 
-				if !engine.fixedDepth() && engine.clock.halt {
-					break
-				}
+			if game.engine.halted() {
+				break
+			}
 
-				if score <= alpha {
+			if score <= alpha {
+				if game.line == 0 {
 					game.improving = false
-					alpha = max(score - aspiration, -Checkmate)
-				} else if score >= beta {
-					beta = min(score + aspiration, Checkmate)
-				} else {
-					break;
 				}
-
-				aspiration *= 2
+				alpha = max(score - aspiration, -Checkmate)
+			} else if score >= beta {
+				beta = min(score + aspiration, Checkmate)
+			} else {
+				break;
 			}
-			// TBD: position.cache(game.rootpv[0], score, 0, 0)
+
+			aspiration *= 2
 		}
-		if engine.clock.halt {
-			score = bestScore
+		// TBD: position.cache(game.rootpv[0], score, 0, 0)
+	}
+
+	return let(game.engine.halted(), bestScore, score)
+}
+
+// "The question of whether machines can think is about as relevant as the
+// question of whether submarines can swim." -- Edsger W. Dijkstra
+func (game *Game) Think() Move {
+	game.engine.clock.halt.Store(false)
+	return game.think().Move
+}
+
+// Searches current position the same way Think() does but without printing
+// anything, and returns the search results.
+func (game *Game) Search() Result {
+	game.quiet = true; defer func() { game.quiet = false }()
+	game.engine.clock.halt.Store(false)
+	return game.think()
+}
+
+// The caller clears the halt flag before the search begins so that a "stop"
+// that arrives before the search gets going is not lost.
+func (game *Game) think() Result {
+	engine, start := game.engine, time.Now()
+	game.started, game.reported = start, 0
+	position := game.position()
+	for _, thread := range game.threads {
+		thread.nodes, thread.qnodes = 0, 0
+	}
+	game.lines = nil
+
+	if move := game.bookMove(position); move != 0 {
+		game.waitForStop()
+		game.printBestMove(move, since(start))
+		return Result{ Move: move, Pv: []Move{ move } }
+	}
+
+	game.getReady()
+	score, move, status := 0, Move(0), InProgress
+	completed := 0
+
+	// MultiPV search can't have more lines than there are legal root moves.
+	game.lines = make([]Line, max(1, min(engine.multiPV, len(game.rootMoves(position)))))
+
+	if !engine.uci && !engine.cecp && !game.quiet {
+		fmt.Println(ansiWhite + `Depth   Time     Nodes    QNodes   Nodes/s   Cache    Score   Best` + ansiNone)
+	}
+
+	engine.startClock(game); defer engine.stopClock(); // <-- No ticking unless there is a time limit.
+	game.startHelpers()
+
+	for depth := 1; game.keepThinking(depth, status, move); depth++ {
+		// Assume volatility decreases with each new iteration.
+		game.volatility /= 2.0
+		game.threads[0].seldepth = 0
+
+		// Search MultiPV lines one by one skipping root moves picked by the
+		// preceding lines. There is only one line unless MultiPV is set.
+		for game.line = 0; game.line < len(game.lines); game.line++ {
+			line := &game.lines[game.line]
+			line.score = game.aspirate(position, depth, line.score)
+			if engine.halted() {
+				game.lines = game.lines[:max(1, game.line)] // Drop incomplete lines.
+				break
+			}
 		}
+		game.rankLines()
 
-		move = game.rootpv.moves[0]
+		score, move = game.lines[0].score, game.rootpv.moves[0]
 		status = position.status(move, score)
-		game.printPrincipal(depth, score, status, since(start))
+		for game.line = 0; game.line < len(game.lines); game.line++ {
+			game.printPrincipal(depth, game.lines[game.line].score, status, since(start))
+		}
+		completed = depth
 	}
 
+	game.waitForStop()
+	game.stopHelpers()
+
+	// Stopped before the first iteration was over: any legal move is better
+	// than none.
+	if move == 0 {
+		if moves := game.rootMoves(position); len(moves) > 0 {
+			move = moves[0]
+			game.rootpv.moves[0], game.rootpv.size = move, 1
+		}
+	}
 	game.printBestMove(move, since(start))
 
-	return move
+	result := game.result(completed, score)
+	if completed > 0 {
+		game.learnScore(position.color, result)
+	}
+
+	return result
+}
+
+// The best move can't be reported while pondering or in infinite analysis mode,
+// even if the search is over, until the opponent makes the expected move or the
+// GUI tells us to stop.
+func (game *Game) waitForStop() {
+	for (game.engine.pondering() || game.engine.options.infinite) && !game.engine.halted() {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Packs up the results of the search.
+func (game *Game) result(depth, score int) Result {
+	result := Result{ Depth: depth, Score: score * 100 / onePawn }
+	result.Pv = append([]Move{}, game.rootpv.moves[0:game.rootpv.size]...)
+	if len(result.Pv) > 0 {
+		result.Move = result.Pv[0]
+	}
+	if len(result.Pv) > 1 {
+		result.Ponder = result.Pv[1]
+	}
+	if isMate(score) {
+		result.Score = 0
+		if score > 0 {
+			result.Mate = (Checkmate - score + 1) / 2
+		} else {
+			result.Mate = (-Checkmate - score) / 2
+		}
+	}
+	nodes, qnodes := game.totals()
+	result.Nodes = nodes + qnodes
+
+	return result
 }
 
 // When in doubt, do what the President does ―- guess.
 func (game *Game) keepThinking(depth, status int, move Move) bool {
+	engine := game.engine
 	if depth == 1 || depth > MaxDepth || status != InProgress {
 		return depth == 1
 	}
 
-	if engine.fixedDepth() {
-		return depth <= engine.options.maxDepth
-	} else if engine.clock.halt {
+	// Weaker play means shallower search.
+	if engine.limitStrength && depth > engine.strengthDepth() {
 		return false
 	}
 
+	// Fixed depth is the only limit unless the time is limited too.
+	if engine.halted() {
+		return false
+	} else if engine.fixedDepth() && (depth > engine.options.maxDepth || !(engine.fixedTime() || engine.varyingTime())) {
+		return depth <= engine.options.maxDepth
+	}
+
 	// Stop deepening if it's the only move.
-	gen := NewRootGen(nil, depth)
-	if gen.onlyMove() {
+	if game.threads[0].moveList[0].onlyMove() {
 		//\\ engine.debug("# Depth %02d Only move %s\n", depth, move)
 		return false
 	}
 
 	// Stop if the time left is not enough to gets through the next iteration.
-	if engine.varyingTime() {
+	if engine.varyingTime() && !engine.pondering() {
 		elapsed := engine.elapsed(time.Now())
 		remaining := engine.factor(depth, game.volatility).remaining()
 
@@ -228,10 +489,13 @@ func (game *Game) keepThinking(depth, status int, move Move) bool {
 }
 
 func (game *Game) printBestMove(move Move, duration int64) {
-	if engine.uci {
-		engine.uciBestMove(move, duration)
-	} else {
-		engine.replBestMove(move)
+	if game.quiet {
+		return
+	}
+	if engine := game.engine; engine.uci {
+		engine.uciBestMove(game, move, duration)
+	} else if !engine.cecp { // <-- XBoard front-end makes the move itself.
+		engine.replBestMove(game, move)
 	}
 }
 
@@ -239,58 +503,31 @@ func (game *Game) printBestMove(move Move, duration int64) {
 // and advantage black is -score whereas in UCI +score is advantage current side
 // and -score is advantage opponent.
 func (game *Game) printPrincipal(depth, score, status int, duration int64) {
-	if engine.uci {
-		engine.uciPrincipal(depth, score, duration)
+	if game.quiet {
+		return
+	}
+	if engine := game.engine; engine.uci {
+		game.reported = duration
+		engine.uciPrincipal(game, depth, score, duration)
+	} else if engine.cecp {
+		engine.xboardPrincipal(game, depth, score, duration)
 	} else {
 		if game.position().color == Black {
 			score = -score
 		}
-		engine.replPrincipal(depth, score, status, duration)
+		engine.replPrincipal(game, depth, score, status, duration)
 	}
 }
 
-func (game *Game) saveBest(ply int, move Move) *Game {
-	game.pv[ply].moves[ply] = move
-	game.pv[ply].size = ply + 1
-
-	next := game.pv[ply].size
-	if size := game.pv[next].size; next < MaxPly && size > next {
-		copy(game.pv[ply].moves[next:], game.pv[next].moves[next:size])
-		game.pv[ply].size += size - next
-	}
-
-	return game
-}
-
-func (game *Game) saveGood(depth int, move Move) *Game {
-	if move.isQuiet() {
-		if ply := ply(); move != game.killers[ply][0] {
-			game.killers[ply][1] = game.killers[ply][0]
-			game.killers[ply][0] = move
+// Sends periodic search progress updates to the GUI during long iterations
+// so that it doesn't look like we're frozen.
+func (game *Game) heartbeat() {
+	if engine := game.engine; engine.uci && !game.quiet {
+		if duration := since(game.started); duration - game.reported >= 1000 {
+			game.reported = duration
+			engine.uciProgress(game, duration)
 		}
-		game.history[move.piece()][move.to()] += depth * depth
 	}
-
-	return game
-}
-
-
-func (game *Game) updatePoor(depth int, bestMove Move, mgen *MoveGen) *Game {
-	value := depth * depth
-
-	for move := mgen.nextMove(); move != 0; move = mgen.nextMove() {
-		if move.isQuiet() {
-			game.history[move.piece()][move.to()] = let(move == bestMove, value, -value)
-		}
-	}
-
-	return game
-}
-
-// Checks whether the move is among good moves captured so far and returns its
-// history value.
-func (game *Game) good(move Move) int {
-	return game.history[move.piece()][move.to()]
 }
 
 func (game *Game) String() string {
@@ -22,16 +22,13 @@ type MoveGen struct {
 	pins	Bitmask
 }
 
-// Pre-allocate move generator array (one entry per ply) to avoid garbage
-// collection overhead. Last entry serves for utility move generation, ex. when
-// converting string notations or determining a stalemate.
-var moveList [MaxPly+1]MoveGen
-
-// Returns "new" move generator for the given ply. Since move generator array
-// has been pre-allocated already we simply return a pointer to the existing
-// array element re-initializing all its data.
+// Returns "new" move generator for the given ply. Each search thread has its
+// move generator array (one entry per ply) pre-allocated to avoid garbage
+// collection overhead, so we simply return a pointer to the existing array
+// element re-initializing all its data. Last entry serves for utility move
+// generation, ex. when converting string notations or determining a stalemate.
 func NewGen(p *Position, ply int) (gen *MoveGen) {
-	gen = &moveList[ply]
+	gen = &p.thread.moveList[ply]
 	gen.p = p
 	gen.list = [128]MoveWithScore{}
 	gen.ply = ply
@@ -43,7 +40,7 @@ func NewGen(p *Position, ply int) (gen *MoveGen) {
 
 // Convenience method to return move generator for the current ply.
 func NewMoveGen(p *Position) *MoveGen {
-	return NewGen(p, ply())
+	return NewGen(p, p.thread.ply())
 }
 
 // Returns new move generator for the initial step of iterative deepening
@@ -53,7 +50,7 @@ func NewRootGen(p *Position, depth int) *MoveGen {
 		return NewGen(p, 0) // Zero ply.
 	}
 
-	return &moveList[0]
+	return &p.thread.moveList[0]
 }
 
 func (gen *MoveGen) reset() *MoveGen {
@@ -89,6 +86,22 @@ func (gen *MoveGen) validOnly() *MoveGen {
 	return gen.reset()
 }
 
+// Removes the moves that are not among the given ones. We use it to restrict
+// the root search to the moves requested by "go searchmoves".
+func (gen *MoveGen) searchOnly(moves []Move) *MoveGen {
+	NextMove:
+	for move := gen.nextMove(); move.some(); move = gen.nextMove() {
+		for _, someMove := range moves {
+			if move == someMove {
+				continue NextMove
+			}
+		}
+		gen.remove()
+	}
+
+	return gen.reset()
+}
+
 // Probes a list of generated moves and returns true if it contains at least
 // one valid move.
 func (gen *MoveGen) anyValid() bool {
@@ -167,12 +180,12 @@ func (gen *MoveGen) rank(bestMove Move) *MoveGen {
 			gen.list[i].score = 0xFFFF
 		} else if !move.isQuiet() || move.isEnpassant() {
 			gen.list[i].score = 8192 + move.value()
-		} else if move == game.killers[gen.ply][0] {
+		} else if move == gen.p.thread.killers[gen.ply][0] {
 			gen.list[i].score = 4096
-		} else if move == game.killers[gen.ply][1] {
+		} else if move == gen.p.thread.killers[gen.ply][1] {
 			gen.list[i].score = 2048
 		} else {
-			gen.list[i].score = game.good(move)
+			gen.list[i].score = gen.p.thread.good(move)
 		}
 	}
 
@@ -188,7 +201,7 @@ func (gen *MoveGen) quickRank() *MoveGen {
 		if move := gen.list[i].move; !move.isQuiet() || move.isEnpassant() {
 			gen.list[i].score = 8192 + move.value()
 		} else {
-			gen.list[i].score = game.good(move)
+			gen.list[i].score = gen.p.thread.good(move)
 		}
 	}
 
@@ -15,6 +15,11 @@ func (gen *MoveGen) generateRootMoves() *MoveGen {
 		gen.validOnly().rank(Move(0))
 	}
 
+	// Restrict root moves to the ones we've been told to search.
+	if moves := gen.p.thread.game.engine.options.searchMoves; len(moves) > 0 {
+		gen.searchOnly(moves)
+	}
+
 	return gen
 }
 
@@ -70,10 +75,10 @@ func (gen *MoveGen) kingMoves(color int) *MoveGen {
 
 		kingside, queenside := gen.p.canCastle(color)
 		if kingside {
-			gen.moveKing(square, bit[G1 + 56 * color])
+			gen.add(NewCastle(gen.p, square, gen.p.castling().rook[color][Kingside]))
 		}
 		if queenside {
-			gen.moveKing(square, bit[C1 + 56 * color])
+			gen.add(NewCastle(gen.p, square, gen.p.castling().rook[color][Queenside]))
 		}
 	}
 
@@ -96,12 +101,7 @@ func (gen *MoveGen) movePawn(square int, targets Bitmask) *MoveGen {
 
 func (gen *MoveGen) moveKing(square int, targets Bitmask) *MoveGen {
 	for bm := targets; bm.any(); bm = bm.pop() {
-		target := bm.first()
-		if abs(square - target) == 2 {
-			gen.add(NewCastle(gen.p, square, target))
-		} else {
-			gen.add(NewMove(gen.p, square, target))
-		}
+		gen.add(NewMove(gen.p, square, bm.first()))
 	}
 
 	return gen
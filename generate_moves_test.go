@@ -156,3 +156,12 @@ func TestGenerateMoves300(t *testing.T) {
 	gen.rearrangeRootMoves().reset()
 	expect.Eq(t, gen.allMoves(), `[Ng1-h3 e2-e4 a2-a3 a2-a4 b2-b3 b2-b4 c2-c3 c2-c4 d2-d3 d2-d4 e2-e3 f2-f3 f2-f4 g2-g3 g2-g4 h2-h3 h2-h4 Nb1-a3 Nb1-c3 Ng1-f3]`)
 }
+
+// Restrict root moves.
+func TestGenerateMoves310(t *testing.T) {
+	p := NewGame().start()
+	e2e4, _ := NewMoveFromString(p, `e2e4`)
+	g1f3, _ := NewMoveFromString(p, `Ng1f3`)
+	gen := NewMoveGen(p).generateMoves().validOnly().searchOnly([]Move{ g1f3, e2e4 })
+	expect.Eq(t, gen.allMoves(), `[e2-e4 Ng1-f3]`)
+}
@@ -10,7 +10,7 @@ package donna
 
 func (gen *MoveGen) addQuiet(move Move) *MoveGen {
 	gen.list[gen.tail].move = move
-	gen.list[gen.tail].score = game.good(move)
+	gen.list[gen.tail].score = gen.p.thread.good(move)
 	gen.tail++
 
 	return gen
@@ -25,13 +25,13 @@ func (gen *MoveGen) generateQuiets() *MoveGen {
 
 	// Castles.
 	if !p.isInCheck(color) {
-		home := homeKing[color]
+		home, castling := p.king[color], p.castling()
 		kingside, queenside := p.canCastle(color)
 		if kingside {
-			gen.addQuiet(NewCastle(p, home, home + 2))
+			gen.addQuiet(NewCastle(p, home, castling.rook[color][Kingside]))
 		}
 		if queenside {
-			gen.addQuiet(NewCastle(p, home, home - 2))
+			gen.addQuiet(NewCastle(p, home, castling.rook[color][Queenside]))
 		}
 	}
 
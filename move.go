@@ -57,7 +57,13 @@ func NewEnpassant(p *Position, from, to int) Move {
 	return Move(from | (to << 8) | (int(p.pieces[from] << 16)) | isEnpassant)
 }
 
+// Castles are encoded as the king taking its own rook. The target square could
+// also be given as king's destination, ex. NewCastle(p, E1, G1).
 func NewCastle(p *Position, from, to int) Move {
+	if piece := p.pieces[from]; p.pieces[to] != rook(piece.color()) {
+		color := piece.color()
+		to = p.castling().rook[color][p.castling().side(color, from, to)]
+	}
 	return Move(from | (to << 8) | (int(p.pieces[from]) << 16) | isCastle)
 }
 
@@ -74,9 +80,13 @@ func NewMoveFromNotation(p *Position, e2e4 string) Move {
 	from := square(int(e2e4[1] - '1'), int(e2e4[0] - 'a'))
 	to := square(int(e2e4[3] - '1'), int(e2e4[2] - 'a'))
 
-	// Check if this is a castle.
-	if p.pieces[from].isKing() && abs(from - to) == 2 {
-		return NewCastle(p, from, to)
+	// Check if this is a castle: either the king moves two squares from its
+	// home, or (Chess960 notation) the king takes its own rook.
+	if piece := p.pieces[from]; piece.isKing() {
+		color := piece.color()
+		if p.pieces[to] == rook(color) || (from == p.castling().king[color] && abs(from - to) == 2 && (col(to) == 6 || col(to) == 2)) {
+			return NewCastle(p, from, to)
+		}
 	}
 
 	// Special handling for pawn pushes because they might cause en-passant
@@ -101,8 +111,9 @@ func NewMoveFromNotation(p *Position, e2e4 string) Move {
 	return NewMove(p, from, to)
 }
 
-// Decodes a string in long algebraic notation and returns a move. All invalid
-// moves are discarded and returned as Move(0).
+// Decodes a string in long algebraic notation or, failing that, in Standard
+// Algebraic Notation and returns a move. All invalid moves are discarded and
+// returned as Move(0).
 func NewMoveFromString(p *Position, e2e4 string) (move Move, validMoves []Move) {
 	re := regexp.MustCompile(`([KkQqRrBbNn]?)([a-h])([1-8])[-x]?([a-h])([1-8])([QqRrBbNn]?)\+?[!\?]{0,2}`)
 	matches := re.FindStringSubmatch(e2e4)
@@ -148,16 +159,16 @@ func NewMoveFromString(p *Position, e2e4 string) (move Move, validMoves []Move)
 	if e2e4 == `0-0` || e2e4 == `0-0-0` {
 		kingside, queenside := p.canCastle(p.color)
 		if e2e4 == `0-0` && kingside {
-			from, to := p.king[p.color], G1 + p.color * A8
-			move = NewCastle(p, from, to)
+			move = NewCastle(p, p.king[p.color], p.castling().rook[p.color][Kingside])
 			return
 		}
 		if e2e4 == `0-0-0` && queenside {
-			from, to := p.king[p.color], C1 + p.color * A8
-			move = NewCastle(p, from, to)
+			move = NewCastle(p, p.king[p.color], p.castling().rook[p.color][Queenside])
 			return
 		}
 	}
+
+	move = NewMoveFromSan(p, e2e4)
 	return
 }
 
@@ -239,11 +250,6 @@ func (m Move) isPawnAdvance() bool {
 	return m.piece().isPawn() && rank(m.color(), m.to()) > A4H4
 }
 
-// Returns true is the move is one of the killer moves at given ply.
-func (m Move) isKiller(ply int) bool {
-	return m.some() && (m == game.killers[ply][0] || m == game.killers[ply][1])
-}
-
 // Returns true if *non-evasion* move is valid, i.e. it is possible to make
 // the move in current position without violating chess rules.
 //
@@ -281,8 +287,23 @@ func (m Move) legit(p *Position, pins Bitmask) bool {
 	color := m.color()
 	from, to, piece, capture := m.split()
 
-	// `from` must have a piece and `to` can't have a piece of the same color.
-	if p.outposts[piece].off(from) || p.outposts[color].on(to) {
+	// `from` must have a piece.
+	if p.outposts[piece].off(from) {
+		return false
+	}
+
+	// Castle is the king taking its own rook on castling rook's home square.
+	if m.isCastle() {
+		castling := p.castling()
+		if !piece.isKing() || from != castling.king[color] || p.outposts[rook(color)].off(to) {
+			return false
+		}
+		kingside, queenside := p.canCastle(color)
+		return (kingside && to == castling.rook[color][Kingside]) || (queenside && to == castling.rook[color][Queenside])
+	}
+
+	// `to` can't have a piece of the same color.
+	if p.outposts[color].on(to) {
 		return false
 	}
 
@@ -318,34 +339,11 @@ func (m Move) legit(p *Position, pins Bitmask) bool {
 		return false
 	}
 
-	// Now check king moves including castles.
+	// Now check king moves, castles are already taken care of.
 	if piece.isKing() {
-		if m.isCastle() {
-			if from != homeKing[color] {
-				return false
-			}
-			switch to {
-			case G1, G8:
-				if p.outposts[rook(color)].off(to + 1) || (p.castles & castleKingside[color] == 0) || (gapKing[color] & p.board).any() {
-					return false
-				}
-				return (castleKing[color] & p.allAttacks(color^1)).empty()
-			case C1, C8:
-				if p.outposts[rook(color)].off(to - 2) || (p.castles & castleQueenside[color] == 0) || (gapQueen[color] & p.board).any() {
-					return false
-				}
-				return (castleQueen[color] & p.allAttacks(color^1)).empty()
-			}
-			return false
-		}
 		return p.kingAttacksAt(from, color).on(to)
 	}
 
-	// Anything castle-related is now non-legit.
-	if m.isCastle() {
-		return false
-	}
-
 	// Check remaining pieces.
 	switch piece.kind() {
 	case Knight:
@@ -362,11 +360,26 @@ func (m Move) legit(p *Position, pins Bitmask) bool {
 }
 
 // Returns string representation of the move in long coordinate notation as
-// expected by UCI, ex. `g1f3`, `e4d5` or `h7h8q`.
+// expected by UCI, ex. `g1f3`, `e4d5` or `h7h8q`. Castles are shown as king's
+// move, ex. `e1g1`.
 func (m Move) notation() string {
+	from, to, _, _ := m.split()
+	if m.isCastle() {
+		to = square(row(from), let(to > from, 6, 2))
+	}
+
+	return m.coordinates(from, to)
+}
+
+// Returns the move in coordinate notation used by Chess960 GUIs where castles
+// are shown as the king taking its own rook, ex. `e1h1` or `b1a1`.
+func (m Move) notation960() string {
+	return m.coordinates(m.from(), m.to())
+}
+
+func (m Move) coordinates(from, to int) string {
 	var buffer bytes.Buffer
 
-	from, to, _, _ := m.split()
 	buffer.WriteByte(byte(col(from)) + 'a')
 	buffer.WriteByte(byte(row(from)) + '1')
 	buffer.WriteByte(byte(col(to)) + 'a')
@@ -378,19 +391,13 @@ func (m Move) notation() string {
 	return buffer.String()
 }
 
-// Returns string representation of the move in long algebraic notation using
-// ASCII characters only.
-func (m Move) str() (str string) {
-	if engine.fancy {
-		defer func() { engine.fancy = true }()
-		engine.fancy = false
-	}
-
-	return m.String()
+// Returns the move in coordinate notation as expected by UCI, ex. `e2e4`.
+func (m Move) Notation() string {
+	return m.notation()
 }
 
-// By default the move is represented in long algebraic notation utilizing fancy
-// UTF-8 engine setting. For example: `♘g1-f3` (fancy), `e4xd5` or `h7-h8Q`.
+// By default the move is represented in long algebraic notation, for example
+// `Ng1-f3`, `e4xd5` or `h7-h8Q`.
 // This notation is used in tests, REPL, and when showing principal variation.
 func (m Move) String() (str string) {
 	var buffer bytes.Buffer
@@ -0,0 +1,175 @@
+// Copyright (c) 2014-2018 by Michael Dvorkin. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+//
+// I am making my contributions/submissions to this project solely in my
+// personal capacity and am not conveying any rights to any intellectual
+// property of any third parties.
+
+package donna
+
+import (
+	`bytes`
+	`regexp`
+	`strings`
+)
+
+// Piece letter, optional source file and rank, optional capture, destination
+// square, and optional promotion, ex. `Nbd7`, `R1xa3`, `exd6` or `e8=Q`.
+var reSan = regexp.MustCompile(`^([KQRBN]?)([a-h]?)([1-8]?)x?([a-h][1-8])(?:=?([QRBNqrbn]))?$`)
+
+// Returns the list of valid moves in the position. We use the utility move
+// generator slot (the last one) so that the call never clobbers the root move
+// list when the position is the root of the search.
+func (p *Position) validMoves() []Move {
+	return NewGen(p, MaxPly).generateAllMoves().validOnly().allMoves()
+}
+
+// Returns the move in Standard Algebraic Notation, ex. `Nbd7`, `exd6`, `O-O-O`,
+// `e8=Q+` or `Rxf7#`. The move is expected to be valid in the position.
+func (p *Position) san(move Move) string {
+	var buffer bytes.Buffer
+
+	from, to, piece, capture := move.split()
+	if move.isCastle() {
+		if buffer.WriteString(`O-O`); to < from {
+			buffer.WriteString(`-O`)
+		}
+	} else {
+		if piece.isPawn() {
+			if capture.some() {
+				buffer.WriteByte(byte(col(from)) + 'a')
+			}
+		} else {
+			buffer.WriteByte(piece.char())
+
+			// Disambiguate when other pieces of the same kind can reach the
+			// target square: file first, then rank, then both.
+			sameFile, sameRank, ambiguous := false, false, false
+			for _, other := range p.validMoves() {
+				if other != move && other.piece() == piece && other.to() == to && !other.isCastle() {
+					ambiguous = true
+					sameFile = sameFile || col(other.from()) == col(from)
+					sameRank = sameRank || row(other.from()) == row(from)
+				}
+			}
+			if ambiguous {
+				if !sameFile || sameRank {
+					buffer.WriteByte(byte(col(from)) + 'a')
+				}
+				if sameFile {
+					buffer.WriteByte(byte(row(from)) + '1')
+				}
+			}
+		}
+		if capture.some() {
+			buffer.WriteByte('x')
+		}
+		buffer.WriteByte(byte(col(to)) + 'a')
+		buffer.WriteByte(byte(row(to)) + '1')
+		if promo := move.promo(); promo.some() {
+			buffer.WriteByte('=')
+			buffer.WriteByte(promo.char())
+		}
+	}
+
+	// Make the move to see whether it checks or mates.
+	position := p.makeMove(move)
+	if position.isInCheck(position.color) {
+		if NewGen(position, MaxPly).generateAllMoves().anyValid() {
+			buffer.WriteByte('+')
+		} else {
+			buffer.WriteByte('#')
+		}
+	}
+	position.undoLastMove()
+
+	return buffer.String()
+}
+
+// Returns the move in Standard Algebraic Notation.
+func (p *Position) San(move Move) string {
+	return p.san(move)
+}
+
+// Returns alternative moves in the position (ex. the list of valid moves) in
+// Standard Algebraic Notation.
+func (p *Position) sanList(moves []Move) (list []string) {
+	for _, move := range moves {
+		list = append(list, p.san(move))
+	}
+
+	return list
+}
+
+// Returns space-separated sequence of moves (ex. principal variation) in
+// Standard Algebraic Notation. The moves are made and then taken back.
+func (p *Position) sanLine(moves []Move) string {
+	var line []string
+
+	position := p
+	for _, move := range moves {
+		line = append(line, position.san(move))
+		position = position.makeMove(move)
+	}
+	for range moves {
+		position = position.undoLastMove()
+	}
+
+	return strings.Join(line, ` `)
+}
+
+// Decodes a string in Standard Algebraic Notation and returns a move. Check
+// and mate markers, annotations, and en-passant suffix are optional, and castles
+// could be given with either letters or zeros. Invalid or ambiguous moves are
+// returned as Move(0).
+func NewMoveFromSan(p *Position, san string) Move {
+	san = strings.TrimSpace(san)
+	san = strings.TrimRight(san, `+#!?`)
+	san = strings.TrimSuffix(strings.TrimSuffix(san, `e.p.`), `ep`)
+	san = strings.TrimSpace(san)
+
+	validMoves := p.validMoves()
+
+	switch san {
+	case `O-O`, `0-0`, `O-O-O`, `0-0-0`:
+		for _, move := range validMoves {
+			if move.isCastle() && (move.to() > move.from()) == (len(san) == 3) {
+				return move
+			}
+		}
+		return Move(0)
+	}
+
+	matches := reSan.FindStringSubmatch(san)
+	if len(matches) == 0 {
+		return Move(0)
+	}
+
+	kind := Pawn
+	if letter := matches[1]; letter != `` {
+		kind = map[string]int{ `K`: King, `Q`: Queen, `R`: Rook, `B`: Bishop, `N`: Knight }[letter]
+	}
+	to := square(int(matches[4][1] - '1'), int(matches[4][0] - 'a'))
+	promo := 0
+	if letter := matches[5]; letter != `` {
+		promo = map[byte]int{ 'Q': Queen, 'R': Rook, 'B': Bishop, 'N': Knight }[strings.ToUpper(letter)[0]]
+	}
+
+	found := Move(0)
+	for _, move := range validMoves {
+		from := move.from()
+		if move.isCastle() || move.to() != to || move.piece().kind() != kind || move.promo().kind() != promo {
+			continue
+		}
+		if (matches[2] != `` && col(from) != int(matches[2][0] - 'a')) || (matches[3] != `` && row(from) != int(matches[3][0] - '1')) {
+			continue
+		}
+		if found.some() {
+			return Move(0) // Ambiguous.
+		}
+		found = move
+	}
+
+	return found
+}
@@ -237,3 +237,73 @@ func TestMove340(t *testing.T) {
 	expect.Eq(t, bK & isCapture, Move(0))
 	expect.Ne(t, bP & isCapture, Move(0)) // Ne() for Pawn.
 }
+
+// Standard Algebraic Notation: disambiguation by file, rank, or both.
+func TestMove400(t *testing.T) {
+	p := NewGame(`Kc2,Nb1,Nf3,Ra1,Ra5,Qe4,Qh4,Qh1`, `Kg8`).start()
+	expect.Eq(t, p.san(NewMove(p, B1, D2)), `Nbd2`)
+	expect.Eq(t, p.san(NewMove(p, A1, A3)), `R1a3`)
+	expect.Eq(t, p.san(NewMove(p, A5, A3)), `R5a3`)
+	expect.Eq(t, p.san(NewMove(p, H1, H2)), `Q1h2`)
+	expect.Eq(t, p.san(NewMove(p, H4, E1)), `Qh4e1`)
+	expect.Eq(t, p.san(NewMove(p, E4, E8)), `Qe8+`)
+}
+
+// Pawn captures, en-passant, promotions, castles, checks and mates.
+func TestMove410(t *testing.T) {
+	p := NewGame(`Ke1,Rh1,e5,a7`, `Kc8,d7,h7,Rb8`).start()
+	expect.Eq(t, p.san(NewCastle(p, E1, G1)), `O-O`)
+	expect.Eq(t, p.san(NewMove(p, A7, A8).promote(Queen)), `a8=Q`)
+	expect.Eq(t, p.san(NewMove(p, A7, B8).promote(Knight)), `axb8=N`)
+	expect.Eq(t, p.san(NewMove(p, H1, H7)), `Rxh7`)
+
+	p = p.makeMove(NewMove(p, H1, H2))
+	p = p.makeMove(NewEnpassant(p, D7, D5))
+	expect.Eq(t, p.san(NewMove(p, E5, D6)), `exd6`)
+
+	p = NewGame(`Kg1,Rf1,Qb3,Bc4`, `Kh8,Rf7,g7,h7`).start()
+	expect.Eq(t, p.san(NewMove(p, C4, F7)), `Bxf7`)
+	expect.Eq(t, p.san(NewMove(p, F1, F7)), `Rxf7`)
+	p = NewGame(`Kg1,Rf1,Bc4`, `Kh8,Qf8,g7,h7`).start()
+	expect.Eq(t, p.san(NewMove(p, F1, F8)), `Rxf8#`)
+}
+
+// Parsing Standard Algebraic Notation.
+func TestMove420(t *testing.T) {
+	p := NewGame(`Kc2,Nb1,Nf3,Ra1,Ra5,Qe4,Qh4,Qh1`, `Kg8`).start()
+	expect.Eq(t, NewMoveFromSan(p, `Nbd2`), NewMove(p, B1, D2))
+	expect.Eq(t, NewMoveFromSan(p, `Nfd2`), NewMove(p, F3, D2))
+	expect.Eq(t, NewMoveFromSan(p, `Nd2`), Move(0)) // Ambiguous.
+	expect.Eq(t, NewMoveFromSan(p, `R1a3`), NewMove(p, A1, A3))
+	expect.Eq(t, NewMoveFromSan(p, `Qh4e1`), NewMove(p, H4, E1))
+	expect.Eq(t, NewMoveFromSan(p, `Qe8+`), NewMove(p, E4, E8))
+	expect.Eq(t, NewMoveFromSan(p, `Kb3!?`), NewMove(p, C2, B3))
+	expect.Eq(t, NewMoveFromSan(p, `Kc4`), Move(0)) // Can't get there.
+
+	p = NewGame(`Ke1,Rh1,Ra1,e5,a7`, `Kc8,d7,h7,Rb8`).start()
+	expect.Eq(t, NewMoveFromSan(p, `O-O-O`), NewCastle(p, E1, C1))
+	expect.Eq(t, NewMoveFromSan(p, `0-0`), NewCastle(p, E1, G1))
+	expect.Eq(t, NewMoveFromSan(p, `a8=Q`), NewMove(p, A7, A8).promote(Queen))
+	expect.Eq(t, NewMoveFromSan(p, `axb8N`), NewMove(p, A7, B8).promote(Knight))
+	expect.Eq(t, NewMoveFromSan(p, `a8`), Move(0)) // Promotion piece is missing.
+
+	p = p.makeMove(NewMove(p, H1, H2))
+	p = p.makeMove(NewEnpassant(p, D7, D5))
+	expect.Eq(t, NewMoveFromSan(p, `exd6 e.p.`), NewMove(p, E5, D6))
+	expect.Eq(t, NewMoveFromSan(p, `exd6`), NewMove(p, E5, D6))
+}
+
+// SAN as accepted by NewMoveFromString() and principal variation formatting.
+func TestMove430(t *testing.T) {
+	p := NewGame().start()
+	move, _ := NewMoveFromString(p, `Nf3`)
+	expect.Eq(t, move, NewMove(p, G1, F3))
+	move, _ = NewMoveFromString(p, `e4`)
+	expect.Eq(t, move, NewPawnMove(p, E2, E4))
+
+	line := []Move{ NewMove(p, F2, F3) }
+	line = append(line, NewMoveFromNotation(p.makeMove(line[0]), `e7e5`))
+	p = p.undoLastMove()
+	expect.Eq(t, p.sanLine(line), `f3 e5`)
+	expect.Eq(t, NewGame().start().sanLine(nil), ``)
+}
@@ -0,0 +1,264 @@
+// Copyright (c) 2014-2018 by Michael Dvorkin. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+//
+// I am making my contributions/submissions to this project solely in my
+// personal capacity and am not conveying any rights to any intellectual
+// property of any third parties.
+
+package donna
+
+import (
+	`sync`
+	`sync/atomic`
+)
+
+// Perft statistics as they appear in the standard perft tables: the number of
+// leaf nodes along with the captures, en-passant captures, castles, promotions,
+// checks, and checkmates made by the moves on the last ply.
+type PerftStats struct {
+	Nodes       int64
+	Captures    int64
+	Enpassants  int64
+	Castles     int64
+	Promotions  int64
+	Checks      int64
+	Checkmates  int64
+}
+
+// Perft results for one of the root moves.
+type PerftMove struct {
+	Move   Move 		// Root move.
+	Stats  PerftStats 	// Results of the perft after making the move.
+}
+
+// Counts leaf nodes of the move tree of the given depth.
+func (p *Position) Perft(depth int) (total int64) {
+	if depth == 0 {
+		return 1
+	}
+
+	gen := NewGen(p, depth).generateAllMoves()
+	for move := gen.nextMove(); move != 0; move = gen.nextMove() {
+		if !move.valid(p, gen.pins) {
+			continue
+		}
+		position := p.makeMove(move)
+		total += position.Perft(depth - 1)
+		position.undoLastMove()
+	}
+	return
+}
+
+// Runs perft the same way Perft() does while collecting detailed statistics.
+// Checks and checkmates are found by making the leaf moves so it takes a bit
+// longer.
+func (p *Position) PerftStats(depth int) (stats PerftStats) {
+	if depth == 0 {
+		stats.Nodes = 1
+	} else {
+		p.perftStats(depth, &stats)
+	}
+
+	return stats
+}
+
+// Breaks perft results down by root moves. Unless detailed statistics are
+// requested only the nodes are counted.
+func (p *Position) PerftDivide(depth int, detailed bool) (moves []PerftMove) {
+	if depth == 0 {
+		return nil
+	}
+
+	for _, move := range p.validMoves() {
+		perft := PerftMove{ Move: move }
+		position := p.makeMove(move)
+		if !detailed {
+			perft.Stats.Nodes = position.Perft(depth - 1)
+		} else if depth > 1 {
+			position.perftStats(depth - 1, &perft.Stats)
+		} else {
+			perft.Stats.count(p, position, move)
+		}
+		position.undoLastMove()
+		moves = append(moves, perft)
+	}
+
+	return moves
+}
+
+func (p *Position) perftStats(depth int, stats *PerftStats) {
+	gen := NewGen(p, depth).generateAllMoves()
+	for move := gen.nextMove(); move != 0; move = gen.nextMove() {
+		if !move.valid(p, gen.pins) {
+			continue
+		}
+		position := p.makeMove(move)
+		if depth > 1 {
+			position.perftStats(depth - 1, stats)
+		} else {
+			stats.count(p, position, move)
+		}
+		position.undoLastMove()
+	}
+}
+
+// Counts the leaf move made in position p that resulted in the position.
+func (stats *PerftStats) count(p, position *Position, move Move) {
+	stats.Nodes++
+	if move.capture().some() {
+		stats.Captures++
+		if p.enpassant != 0 && move.to() == p.enpassant && move.piece().isPawn() {
+			stats.Enpassants++
+		}
+	}
+	if move.isCastle() {
+		stats.Castles++
+	}
+	if move.isPromo() {
+		stats.Promotions++
+	}
+	if position.isInCheck(position.color) {
+		stats.Checks++
+
+		// The utility move generator slot is never used by perft itself.
+		if !NewGen(position, MaxPly).generateAllMoves().anyValid() {
+			stats.Checkmates++
+		}
+	}
+}
+
+// Adds up the statistics, ex. to get the totals of perft divide.
+func (stats *PerftStats) add(other PerftStats) *PerftStats {
+	stats.Nodes += other.Nodes
+	stats.Captures += other.Captures
+	stats.Enpassants += other.Enpassants
+	stats.Castles += other.Castles
+	stats.Promotions += other.Promotions
+	stats.Checks += other.Checks
+	stats.Checkmates += other.Checkmates
+
+	return stats
+}
+
+// Perft hash table entry. Both words are read and written atomically, and the
+// check word is the position's hash XOR data so that the entries torn apart
+// by concurrent writes get rejected.
+type PerftEntry struct {
+	check  uint64 		// Position hash ^ data.
+	data   uint64 		// Subtree node count << 8 | depth.
+}
+
+type PerftCache []PerftEntry
+
+// Creates perft hash table of the given size in megabytes rounded down to the
+// power of two number of entries. Zero size means no hashing.
+func NewPerftCache(megabytes int) PerftCache {
+	if megabytes <= 0 {
+		return nil
+	}
+
+	size, entries := 1, megabytes * 1024 * 1024 / 16
+	for size * 2 <= entries {
+		size *= 2
+	}
+
+	return make(PerftCache, size)
+}
+
+// Returns cached subtree node count for the position and depth, if any.
+func (cache PerftCache) probe(id uint64, depth int) (int64, bool) {
+	if len(cache) > 0 {
+		entry := &cache[id & uint64(len(cache) - 1)]
+		check, data := atomic.LoadUint64(&entry.check), atomic.LoadUint64(&entry.data)
+		if check ^ data == id && int(data & 0xFF) == depth {
+			return int64(data >> 8), true
+		}
+	}
+
+	return 0, false
+}
+
+// Saves subtree node count for the position and depth replacing whatever was
+// there before.
+func (cache PerftCache) store(id uint64, depth int, nodes int64) {
+	if len(cache) > 0 {
+		entry := &cache[id & uint64(len(cache) - 1)]
+		data := uint64(nodes) << 8 | uint64(depth)
+		atomic.StoreUint64(&entry.data, data)
+		atomic.StoreUint64(&entry.check, id ^ data)
+	}
+}
+
+// Returns the same node count as Perft() does, only much faster: subtree counts
+// are cached by position hash and depth, and root moves are split across the
+// given number of goroutines.
+func (p *Position) PerftHashed(depth, workers, megabytes int) (total int64) {
+	if depth == 0 {
+		return 1
+	}
+
+	for _, perft := range p.PerftParallel(depth, workers, megabytes) {
+		total += perft.Stats.Nodes
+	}
+
+	return total
+}
+
+// Breaks PerftHashed() node counts down by root moves. Each goroutine searches
+// with its own position stack while the hash table is shared.
+func (p *Position) PerftParallel(depth, workers, megabytes int) []PerftMove {
+	if depth == 0 {
+		return nil
+	}
+
+	cache, moves := NewPerftCache(megabytes), p.validMoves()
+	results := make([]PerftMove, len(moves))
+
+	var wait sync.WaitGroup
+	next := int32(-1)
+	for i := 0; i < max(1, min(workers, len(moves))); i++ {
+		wait.Add(1)
+		go func(root *Position) {
+			defer wait.Done()
+			for n := int(atomic.AddInt32(&next, 1)); n < len(moves); n = int(atomic.AddInt32(&next, 1)) {
+				position := root.makeMove(moves[n])
+				results[n] = PerftMove{ Move: moves[n] }
+				results[n].Stats.Nodes = position.perftHashed(depth - 1, cache)
+				position.undoLastMove()
+			}
+		}(NewThread(p.thread.game, i).copyTree(p.thread).position())
+	}
+	wait.Wait()
+
+	return results
+}
+
+func (p *Position) perftHashed(depth int, cache PerftCache) (total int64) {
+	if depth == 0 {
+		return 1
+	}
+	if nodes, ok := cache.probe(p.id, depth); ok {
+		return nodes
+	}
+
+	// Leaf moves are counted without making them.
+	gen := NewGen(p, depth).generateAllMoves()
+	for move := gen.nextMove(); move != 0; move = gen.nextMove() {
+		if !move.valid(p, gen.pins) {
+			continue
+		}
+		if depth == 1 {
+			total++
+		} else {
+			position := p.makeMove(move)
+			total += position.perftHashed(depth - 1, cache)
+			position.undoLastMove()
+		}
+	}
+	if depth > 1 {
+		cache.store(p.id, depth, total)
+	}
+
+	return total
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2014-2018 by Michael Dvorkin. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+//
+// I am making my contributions/submissions to this project solely in my
+// personal capacity and am not conveying any rights to any intellectual
+// property of any third parties.
+
+package donna
+
+import(`github.com/michaeldv/donna/expect`; `testing`)
+
+// Detailed perft statistics.
+func TestPerft000(t *testing.T) {
+	p := NewGame(`r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1`).start()
+	expect.Eq(t, p.PerftStats(3), PerftStats{ 97862, 17102, 45, 3162, 0, 993, 1 })
+}
+
+func TestPerft010(t *testing.T) {
+	p := NewGame(`8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1`).start()
+	expect.Eq(t, p.PerftStats(4), PerftStats{ 43238, 3348, 123, 0, 0, 1680, 17 })
+}
+
+func TestPerft020(t *testing.T) {
+	p := NewGame(`r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1`).start()
+	expect.Eq(t, p.PerftStats(3), PerftStats{ 9467, 1021, 4, 0, 120, 38, 22 })
+	expect.Eq(t, p.PerftStats(0), PerftStats{ Nodes: 1 })
+}
+
+// Perft divide.
+func TestPerft100(t *testing.T) {
+	p := NewGame().start()
+	divide := p.PerftDivide(3, false)
+	expect.Eq(t, len(divide), 20)
+
+	var total PerftStats
+	for _, perft := range divide {
+		if perft.Move.notation() == `e2e4` {
+			expect.Eq(t, perft.Stats.Nodes, int64(600))
+		}
+		total.add(perft.Stats)
+	}
+	expect.Eq(t, total.Nodes, int64(8902))
+}
+
+func TestPerft110(t *testing.T) {
+	p := NewGame(`r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1`).start()
+
+	var total PerftStats
+	for _, perft := range p.PerftDivide(2, true) {
+		total.add(perft.Stats)
+	}
+	expect.Eq(t, total, PerftStats{ 2039, 351, 1, 91, 0, 3, 0 })
+	expect.Eq(t, p.fen(), `r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1`)
+}
+
+// Hashed and parallel perft.
+func TestPerft200(t *testing.T) {
+	p := NewGame(`r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1`).start()
+	expect.Eq(t, p.PerftHashed(0, 4, 1), int64(1))
+	expect.Eq(t, p.PerftHashed(4, 1, 0), int64(4085603))
+	expect.Eq(t, p.PerftHashed(4, 4, 1), int64(4085603))
+	expect.Eq(t, p.PerftHashed(4, 64, 1), int64(4085603))
+}
+
+func TestPerft210(t *testing.T) {
+	p := NewGame(`8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1`).start()
+	plain, hashed := p.PerftDivide(5, false), p.PerftParallel(5, 3, 1)
+	expect.Eq(t, len(hashed), len(plain))
+	for i := range plain {
+		expect.Eq(t, hashed[i], plain[i])
+	}
+	expect.Eq(t, p.fen(), `8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1`)
+}
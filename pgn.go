@@ -0,0 +1,292 @@
+// Copyright (c) 2014-2018 by Michael Dvorkin. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+//
+// I am making my contributions/submissions to this project solely in my
+// personal capacity and am not conveying any rights to any intellectual
+// property of any third parties.
+
+package donna
+
+import (
+	`bytes`
+	`fmt`
+	`regexp`
+	`strings`
+	`time`
+)
+
+// PGN tag pair, ex. [Event "F/S Return Match"].
+type PgnTag struct {
+	name   string
+	value  string
+}
+
+// Game as it appears in PGN file: tag pairs followed by main line moves in
+// Standard Algebraic Notation. Comments, NAGs, and variations are skipped.
+type PgnGame struct {
+	tags    []PgnTag 	// Tag pairs in the order of appearance.
+	moves   []string 	// Main line moves in SAN.
+	result  string   	// Game termination marker.
+}
+
+// Seven Tag Roster in the order required by the PGN standard.
+var pgnRoster = []string{ `Event`, `Site`, `Date`, `Round`, `White`, `Black`, `Result` }
+
+// Move number indicator, ex. `12.` or `12...`, optionally glued to the move.
+var rePgnNumber = regexp.MustCompile(`^[0-9]+(\.+|$)`)
+
+// Returns tag value or blank string if the tag is missing.
+func (pgn *PgnGame) tag(name string) string {
+	for _, tag := range pgn.tags {
+		if tag.name == name {
+			return tag.value
+		}
+	}
+
+	return ``
+}
+
+// Splits PGN text into games. Move numbers, comments (both braced and rest of
+// the line ones), numeric annotation glyphs, and recursive annotation variations
+// are recognized and left out.
+func ParsePgn(text string) (games []PgnGame, err error) {
+	var game PgnGame
+
+	finish := func() {
+		if len(game.tags) > 0 || len(game.moves) > 0 || game.result != `` {
+			games = append(games, game)
+		}
+		game = PgnGame{}
+	}
+
+	depth, size := 0, len(text)
+	for i := 0; i < size; i++ {
+		switch char := text[i]; {
+		case char == ' ' || char == '\t' || char == '\r' || char == '\n':
+			// Skip white space.
+		case char == '%' && (i == 0 || text[i-1] == '\n'), char == ';':
+			for i < size && text[i] != '\n' { // Escape and comment lines.
+				i++
+			}
+		case char == '{':
+			end := strings.IndexByte(text[i:], '}')
+			if end < 0 {
+				return games, fmt.Errorf(`unterminated comment`)
+			}
+			i += end
+		case char == '(':
+			depth++
+		case char == ')':
+			if depth--; depth < 0 {
+				return games, fmt.Errorf(`unexpected ')'`)
+			}
+		case char == '[':
+			if len(game.moves) > 0 || game.result != `` {
+				finish() // Tag pairs of the next game.
+			}
+			tag, next, err := parsePgnTag(text, i + 1)
+			if err != nil {
+				return games, err
+			}
+			game.tags, i = append(game.tags, tag), next
+		default:
+			start := i
+			for i < size && strings.IndexByte(" \t\r\n[]{}();", text[i]) < 0 {
+				i++
+			}
+			token := text[start:i]
+			i--
+
+			if depth > 0 || token[0] == '$' {
+				continue // Variation or NAG.
+			}
+			switch token {
+			case `1-0`, `0-1`, `1/2-1/2`, `*`:
+				game.result = token
+				finish()
+			case `e.p.`: // En-passant suffix.
+			default:
+				if token = rePgnNumber.ReplaceAllLiteralString(token, ``); token != `` {
+					game.moves = append(game.moves, token)
+				}
+			}
+		}
+	}
+	if depth > 0 {
+		return games, fmt.Errorf(`unterminated variation`)
+	}
+	finish()
+
+	return games, nil
+}
+
+// Parses tag pair starting right after the opening bracket. Returns the tag
+// and index of the closing bracket.
+func parsePgnTag(text string, i int) (tag PgnTag, next int, err error) {
+	end := strings.IndexByte(text[i:], '"')
+	if end < 0 {
+		return tag, i, fmt.Errorf(`invalid tag pair`)
+	}
+	tag.name = strings.TrimSpace(text[i:i + end])
+
+	var value bytes.Buffer
+	for i += end + 1; i < len(text) && text[i] != '"'; i++ {
+		if text[i] == '\\' && i + 1 < len(text) {
+			i++
+		}
+		value.WriteByte(text[i])
+	}
+	tag.value = value.String()
+
+	if end = strings.IndexByte(text[i:], ']'); tag.name == `` || end < 0 {
+		return tag, i, fmt.Errorf(`invalid tag pair`)
+	}
+
+	return tag, i + end, nil
+}
+
+// Returns n-th game (starting with 1) from PGN text with all its moves made.
+func (e *Engine) NewGameFromPgn(text string, n int) (*Game, error) {
+	games, err := ParsePgn(text)
+	if err != nil {
+		return nil, err
+	}
+	if n < 1 || n > len(games) {
+		return nil, fmt.Errorf(`game %d not found, there are %d game(s)`, n, len(games))
+	}
+
+	pgn := games[n - 1]
+	game := e.NewGame()
+	if fen := pgn.tag(`FEN`); fen != `` {
+		game = e.NewGame(fen)
+	}
+	position, err := game.setup()
+	if err != nil {
+		return nil, fmt.Errorf(`invalid FEN %s: %v`, pgn.tag(`FEN`), err)
+	}
+
+	for _, san := range pgn.moves {
+		move := NewMoveFromSan(position, san)
+		if move.null() {
+			return nil, fmt.Errorf(`invalid move %s after %d plies`, san, len(game.moves))
+		}
+		position = game.makeMove(move)
+	}
+	game.tags = pgn.tags
+	if pgn.tag(`Result`) == `` && pgn.result != `` {
+		game.tags = append(game.tags, PgnTag{ `Result`, pgn.result })
+	}
+
+	return game, nil
+}
+
+// Returns game result based on current position status. If the game is not
+// over yet the result given by the loaded game (ex. resignation) is used.
+func (game *Game) outcome() string {
+	switch game.position().Status() {
+	case WhiteWon:
+		return `1-0`
+	case BlackWon:
+		return `0-1`
+	case Stalemate, Insufficient, Repetition, FiftyMoves:
+		return `1/2-1/2`
+	}
+
+	for _, tag := range game.tags {
+		if tag.name == `Result` && tag.value != `` {
+			return tag.value
+		}
+	}
+
+	return `*`
+}
+
+// Returns the game in PGN format: Seven Tag Roster followed by any other tags
+// the game was loaded with, and movetext in Standard Algebraic Notation.
+func (game *Game) Pgn() string {
+	var buffer bytes.Buffer
+
+	pgn, result := PgnGame{ tags: game.tags }, game.outcome()
+	for _, name := range pgnRoster {
+		value := pgn.tag(name)
+		switch {
+		case name == `Result`:
+			value = result
+		case name == `Date` && value == ``:
+			value = time.Now().Format(`2006.01.02`)
+		case value == ``:
+			value = `?`
+		}
+		fmt.Fprintf(&buffer, "[%s \"%s\"]\n", name, pgnEscape(value))
+	}
+
+	// The moves were made on top of the initial position so we walk the
+	// position tree from there.
+	t := game.threads[0]
+	base := t.node - len(game.moves)
+	initial := &t.tree[base]
+	if game.castling.chess960 && pgn.tag(`Variant`) == `` {
+		buffer.WriteString("[Variant \"Chess960\"]\n")
+	}
+	if fen := initial.fen(); fen != initialFen {
+		fmt.Fprintf(&buffer, "[SetUp \"1\"]\n[FEN \"%s\"]\n", fen)
+	}
+	for _, tag := range game.tags {
+		if !pgnStandard(tag.name) {
+			fmt.Fprintf(&buffer, "[%s \"%s\"]\n", tag.name, pgnEscape(tag.value))
+		}
+	}
+	buffer.WriteByte('\n')
+
+	var tokens []string
+	number := initial.fullmove
+	for i, move := range game.moves {
+		position := &t.tree[base + i]
+		if position.color == White {
+			tokens = append(tokens, fmt.Sprintf(`%d.`, number))
+		} else if i == 0 {
+			tokens = append(tokens, fmt.Sprintf(`%d...`, number))
+		}
+		if tokens = append(tokens, position.san(move)); position.color == Black {
+			number++
+		}
+	}
+	tokens = append(tokens, result)
+	pgnWrap(&buffer, tokens)
+	buffer.WriteString("\n\n")
+
+	return buffer.String()
+}
+
+// Writes movetext tokens wrapping the lines at 80 characters.
+func pgnWrap(buffer *bytes.Buffer, tokens []string) {
+	width := 0
+	for i, token := range tokens {
+		if i > 0 && width + 1 + len(token) > 80 {
+			buffer.WriteByte('\n')
+			width = 0
+		} else if i > 0 {
+			buffer.WriteByte(' ')
+			width++
+		}
+		buffer.WriteString(token)
+		width += len(token)
+	}
+}
+
+// Returns true if the tag is handled by the PGN writer itself.
+func pgnStandard(name string) bool {
+	for _, tag := range pgnRoster {
+		if name == tag {
+			return true
+		}
+	}
+
+	return name == `SetUp` || name == `FEN`
+}
+
+// Escapes quotes and backslashes in tag values.
+func pgnEscape(value string) string {
+	return strings.Replace(strings.Replace(value, `\`, `\\`, -1), `"`, `\"`, -1)
+}
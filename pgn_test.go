@@ -0,0 +1,114 @@
+// Copyright (c) 2014-2018 by Michael Dvorkin. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+//
+// I am making my contributions/submissions to this project solely in my
+// personal capacity and am not conveying any rights to any intellectual
+// property of any third parties.
+
+package donna
+
+import(`github.com/michaeldv/donna/expect`; `testing`)
+
+const pgnSample = `[Event "Casual \"blitz\" game"]
+[Site "?"]
+[Date "2018.01.01"]
+[Round "1"]
+[White "Alice"]
+[Black "Bob"]
+[Result "1-0"]
+[ECO "C50"]
+
+1. e4 e5 {Open game} 2. Nf3 $1 Nc6 (2... d6 3. d4 (3. Bc4 Be7) exd4) 3. Bc4
+Nd4 ; Blunder
+4. Nxe5 Qg5 5. Nxf7 Qxg2 6. Rf1 Qxe4+ 7. Be2 Nf3# 0-1
+
+[Event "Second"]
+[Result "*"]
+
+1.d4 d5 2.c4 *
+`
+
+// Tags, comments, NAGs, and nested variations.
+func TestPgn000(t *testing.T) {
+	games, err := ParsePgn(pgnSample)
+	expect.Eq(t, err, nil)
+	expect.Eq(t, len(games), 2)
+	expect.Eq(t, games[0].tag(`Event`), `Casual "blitz" game`)
+	expect.Eq(t, games[0].tag(`ECO`), `C50`)
+	expect.Eq(t, len(games[0].moves), 14)
+	expect.Eq(t, games[0].moves[4], `Bc4`)
+	expect.Eq(t, games[0].result, `0-1`)
+	expect.Eq(t, games[1].moves, []string{ `d4`, `d5`, `c4` })
+	expect.Eq(t, games[1].result, `*`)
+
+	_, err = ParsePgn(`1. e4 (1. d4 e5`)
+	expect.Ne(t, err, nil)
+	_, err = ParsePgn(`1. e4 {e5`)
+	expect.Ne(t, err, nil)
+}
+
+// Loading the game makes its moves.
+func TestPgn010(t *testing.T) {
+	game, err := NewEngine().NewGameFromPgn(pgnSample, 1)
+	expect.Eq(t, err, nil)
+	expect.Eq(t, len(game.moves), 14)
+	expect.Eq(t, game.position().Status(), BlackWon)
+	expect.Eq(t, game.position().dcf(), `Ke1,Qd1,Ra1,Rf1,Bc1,Be2,Nb1,Nf7,Cc1,a2,b2,c2,d2,f2,h2 : Ke8,Qe4,Ra8,Rh8,Bc8,Bf8,Nf3,Ng8,a7,b7,c7,d7,g7,h7`)
+
+	game, err = NewEngine().NewGameFromPgn(pgnSample, 2)
+	expect.Eq(t, err, nil)
+	expect.Eq(t, game.position().color, Black)
+
+	_, err = NewEngine().NewGameFromPgn(pgnSample, 3)
+	expect.Ne(t, err, nil)
+	_, err = NewEngine().NewGameFromPgn(`1. e4 e4 *`, 1)
+	expect.Ne(t, err, nil)
+}
+
+// Seven Tag Roster, extra tags, and result derived from the position.
+func TestPgn020(t *testing.T) {
+	game, _ := NewEngine().NewGameFromPgn(pgnSample, 1)
+	expect.Eq(t, game.Pgn(), `[Event "Casual \"blitz\" game"]
+[Site "?"]
+[Date "2018.01.01"]
+[Round "1"]
+[White "Alice"]
+[Black "Bob"]
+[Result "0-1"]
+[ECO "C50"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bc4 Nd4 4. Nxe5 Qg5 5. Nxf7 Qxg2 6. Rf1 Qxe4+ 7. Be2 Nf3#
+0-1
+
+`)
+}
+
+// Games starting from FEN position.
+func TestPgn030(t *testing.T) {
+	game := NewGame(`4k3/8/8/8/8/8/8/4KN2 b - - 0 40`)
+	p := game.start()
+	p = game.makeMove(NewMove(p, E8, D7))
+	p = game.makeMove(NewMove(p, F1, G3))
+	pgn := game.Pgn()
+	expect.Contain(t, pgn, `[Result "1/2-1/2"]`) // Insufficient material.
+	expect.Contain(t, pgn, "[SetUp \"1\"]\n[FEN \"4k3/8/8/8/8/8/8/4KN2 b - - 0 40\"]\n")
+	expect.Contain(t, pgn, "\n40... Kd7 41. Ng3 1/2-1/2\n")
+
+	loaded, err := NewEngine().NewGameFromPgn(pgn, 1)
+	expect.Eq(t, err, nil)
+	expect.Eq(t, loaded.position().fen(), p.fen())
+}
+
+// Moves made through the exported API make it to PGN, and so do take backs.
+func TestPgn040(t *testing.T) {
+	game := NewGame()
+	p := game.Start()
+	p = p.MakeMove(NewMoveFromNotation(p, `e2e4`))
+	p = p.MakeMove(NewMoveFromNotation(p, `e7e5`))
+	p = p.MakeMove(NewMoveFromNotation(p, `g1f3`))
+	p = p.UndoLastMove()
+	pgn := game.Pgn()
+	expect.NotContain(t, pgn, `[FEN `)
+	expect.Contain(t, pgn, "\n1. e4 e5 *\n")
+}
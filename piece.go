@@ -116,12 +116,17 @@ func (p Piece) char() byte {
 	return []byte{ 0, 0, 0, 0, 'N', 'N', 'B', 'B', 'R', 'R', 'Q', 'Q', 'K', 'K' }[p]
 }
 
-func (p Piece) String() string {
-	plain := []string{ ` `, ` `, `P`, `p`, `N`, `n`, `B`, `b`, `R`, `r`, `Q`, `q`, `K`, `k` }
-	fancy := []string{ ` `, ` `, "\u2659", "\u265F", "\u2658", "\u265E", "\u2657", "\u265D", "\u2656", "\u265C", "\u2655", "\u265B", "\u2654", "\u265A" }
+// Returns ASCII representation of the piece: uppercase for white pieces and
+// lowercase for black ones.
+func (p Piece) plain() string {
+	return []string{ ` `, ` `, `P`, `p`, `N`, `n`, `B`, `b`, `R`, `r`, `Q`, `q`, `K`, `k` }[p]
+}
 
-	if engine.fancy {
-		return fancy[p]
-	}
-	return plain[p]
+// Returns UTF-8 chess symbol of the piece.
+func (p Piece) fancy() string {
+	return []string{ ` `, ` `, "\u2659", "\u265F", "\u2658", "\u265E", "\u2657", "\u265D", "\u2656", "\u265C", "\u2655", "\u265B", "\u2654", "\u265A" }[p]
+}
+
+func (p Piece) String() string {
+	return p.plain()
 }
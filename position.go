@@ -13,12 +13,10 @@ import (
 	`fmt`
 	`strconv`
 	`strings`
+	`unicode`
 )
 
-var tree [1024]Position
-var node, rootNode int
-
-type Position struct {		 // 224 bytes long.
+type Position struct {		 // 232 bytes long.
 	id           uint64	 // Polyglot hash value for the position.
 	pawnId       uint64	 // Polyglot hash value for position's pawn structure.
 	board        Bitmask	 // Bitmask of all pieces on the board.
@@ -31,48 +29,44 @@ type Position struct {		 // 224 bytes long.
 	color        int	 // Side to make next move.
 	enpassant    int	 // En-passant square caused by previous move.
 	count50      int	 // 50 moves rule counter.
+	fullmove     int	 // Full move number, starts at 1 and goes up after Black's move.
 	reversible   bool	 // Is this position reversible?
 	castles      uint8	 // Castle rights mask.
+	thread       *Thread	 // Search thread that owns the position.
 }
 
-func NewPosition(game *Game, white, black string) *Position {
-	tree[node] = Position{}
-	p := &tree[node]
+// Initial chess position in FEN.
+const initialFen = `rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1`
 
-	p.setupSide(white, White).setupSide(black, Black)
+func NewPosition(game *Game, white, black string) (*Position, error) {
+	t := game.threads[0]
+	t.tree[t.node] = Position{ thread: t, fullmove: 1 }
+	p := &t.tree[t.node]
+	game.castling = standardCastling
 
-	p.castles = castleKingside[White] | castleQueenside[White] | castleKingside[Black] | castleQueenside[Black]
-	if p.pieces[E1] != King || p.pieces[H1] != Rook {
-		p.castles &= ^castleKingside[White]
-	}
-	if p.pieces[E1] != King || p.pieces[A1] != Rook {
-		p.castles &= ^castleQueenside[White]
-	}
-	if p.pieces[E8] != BlackKing || p.pieces[H8] != BlackRook {
-		p.castles &= ^castleKingside[Black]
+	if err := p.setupSide(white, White); err != nil {
+		return nil, err
 	}
-	if p.pieces[E8] != BlackKing || p.pieces[A8] != BlackRook {
-		p.castles &= ^castleQueenside[Black]
+	if err := p.setupSide(black, Black); err != nil {
+		return nil, err
 	}
 
-	for square, piece := range p.pieces {
-		if piece.some() {
-			p.outposts[piece] |= bit[square]
-			p.outposts[piece.color()] |= bit[square]
-			if piece.isKing() {
-				p.king[piece.color()] = square
+	// Unless castle rights are given explicitly all castles are allowed as
+	// long as the king and the rook are on their home squares.
+	for color := White; color <= Black; color++ {
+		rights := castleKingside[color] | castleQueenside[color]
+		if p.castles & rights == 0 {
+			p.castles |= rights
+			if p.pieces[homeKing[color]] != king(color) || p.pieces[H1 + 56 * color] != rook(color) {
+				p.castles &= ^castleKingside[color]
+			}
+			if p.pieces[homeKing[color]] != king(color) || p.pieces[A1 + 56 * color] != rook(color) {
+				p.castles &= ^castleQueenside[color]
 			}
-			p.balance += materialBalance[piece]
 		}
 	}
 
-	p.reversible = true
-	p.board = p.outposts[White] | p.outposts[Black]
-	p.id, p.pawnId = p.polyglot()
-	p.tally = p.valuation()
-	p.score = Unknown
-
-	return p
+	return p.setup()
 }
 
 // Parses Donna chess format string for one side. Besides [K]ing, [Q]ueen, [R]ook,
@@ -85,163 +79,281 @@ func NewPosition(game *Game, white, black string) *Position {
 // [C]astle:    specifies castle right squares. For example, "Cg1" and "Cc8" encode
 //              allowed kingside castle for White, and queenside castle for Black.
 //              By default all castles are allowed, i.e. defult value is "Cc1,Cg1"
-//              for White and "Cc8,Cg8" for Black. The actual castle rights are
-//              checked during position setup to make sure they do not violate
-//              chess rules. If castle rights are specified incorrectly they are
-//              quietly ignored.
+//              for White and "Cc8,Cg8" for Black. The default castle rights are
+//              quietly adjusted to match the position of kings and rooks, but
+//              the explicit ones that violate chess rules are reported as errors.
+//              Chess960 castle rights can only be given in FEN.
 //
 // [E]npassant: specifies en-passant square if any. For example, "Ed3" marks D3
 //              square as en-passant. Default value is no en-passant.
 //
-func (p *Position) setupSide(str string, color int) *Position {
-	invalid := func (move string, color int) {
-		// Don't panic.
-		panic(fmt.Sprintf("Invalid notation '%s' for %s\n", move, C(color)))
-	}
-
+func (p *Position) setupSide(str string, color int) error {
 	for _, move := range strings.Split(str, `,`) {
-		if move[0] == 'M' { // TODO: parse move number.
+		if move = strings.TrimSpace(move); move == `` {
+			return fmt.Errorf(`missing piece for %s in '%s'`, C(color), str)
+		}
+		if move[0] == 'M' {
 			p.color = color
-		} else {
-			arr := reMove.FindStringSubmatch(move)
-			if len(arr) == 0 {
-				invalid(move, color)
-			}
-			square := square(int(arr[3][0]-'1'), int(arr[2][0]-'a'))
-
-			switch move[0] {
-			case 'K':
-				p.pieces[square] = king(color)
-			case 'Q':
-				p.pieces[square] = queen(color)
-			case 'R':
-				p.pieces[square] = rook(color)
-			case 'B':
-				p.pieces[square] = bishop(color)
-			case 'N':
-				p.pieces[square] = knight(color)
-			case 'E':
-				p.enpassant = square
-			case 'C':
-				if (square == C1 + color) || (square == C8 + color) {
-					p.castles |= castleQueenside[color]
-				} else if (square == G1 + color) || (square == G8 + color) {
-					p.castles |= castleKingside[color]
+			if len(move) > 1 {
+				n, err := strconv.Atoi(move[1:])
+				if err != nil || n < 1 {
+					return fmt.Errorf(`invalid move number '%s' for %s`, move, C(color))
 				}
-			default:
-				// When everything else fails, read the instructions.
-				p.pieces[square] = pawn(color)
+				p.fullmove = n
+			}
+			continue
+		}
+
+		arr := reMove.FindStringSubmatch(move)
+		if len(arr) == 0 || arr[0] != move {
+			return fmt.Errorf(`invalid notation '%s' for %s`, move, C(color))
+		}
+		square := square(int(arr[3][0]-'1'), int(arr[2][0]-'a'))
+
+		switch move[0] {
+		case 'K':
+			p.pieces[square] = king(color)
+		case 'Q':
+			p.pieces[square] = queen(color)
+		case 'R':
+			p.pieces[square] = rook(color)
+		case 'B':
+			p.pieces[square] = bishop(color)
+		case 'N':
+			p.pieces[square] = knight(color)
+		case 'E':
+			p.enpassant = square
+		case 'C':
+			if col(square) == 2 {
+				p.castles |= castleQueenside[color]
+			} else if col(square) == 6 {
+				p.castles |= castleKingside[color]
+			} else {
+				return fmt.Errorf(`invalid castle square '%s' for %s`, move, C(color))
 			}
+		default:
+			// When everything else fails, read the instructions.
+			p.pieces[square] = pawn(color)
 		}
 	}
 
-	return p
+	return nil
 }
 
 // Sets up initial chess position.
 func NewInitialPosition(game *Game) *Position {
-	return NewPositionFromFEN(game, `rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1`)
+	p, _ := NewPositionFromFEN(game, initialFen)
+	return p
 }
 
-// Decodes FEN string and creates new position.
-func NewPositionFromFEN(game *Game, fen string) *Position {
-	tree[node] = Position{}
-	p := &tree[node]
+// Decodes FEN string and creates new position. Half-move clock and full move
+// number are optional and default to 0 and 1 respectively.
+func NewPositionFromFEN(game *Game, fen string) (*Position, error) {
+	t := game.threads[0]
+	t.tree[t.node] = Position{ thread: t, fullmove: 1 }
+	p := &t.tree[t.node]
 
-	// Expected matches of interest are as follows:
+	// Expected fields are as follows:
 	// [0] - Pieces (entire board).
 	// [1] - Color of side to move.
 	// [2] - Castle rights.
 	// [3] - En-passant square.
 	// [4] - Number of half-moves.
 	// [5] - Number of full moves.
-	matches := strings.Split(fen, ` `)
-	if len(matches) < 4 {
-		return nil
+	fields := strings.Fields(fen)
+	if len(fields) < 4 || len(fields) > 6 {
+		return nil, fmt.Errorf(`FEN must have 4 to 6 fields: '%s'`, fen)
 	}
 
-	// [0] - Pieces (entire board).
-	sq := A8
-	for _, char := range(matches[0]) {
-		piece := Piece(0)
-		switch(char) {
-		case 'P':
-			piece = Pawn
-		case 'p':
-			piece = BlackPawn
-		case 'N':
-			piece = Knight
-		case 'n':
-			piece = BlackKnight
-		case 'B':
-			piece = Bishop
-		case 'b':
-			piece = BlackBishop
-		case 'R':
-			piece = Rook
-		case 'r':
-			piece = BlackRook
-		case 'Q':
-			piece = Queen
-		case 'q':
-			piece = BlackQueen
-		case 'K':
-			piece = King
-			p.king[White] = sq
-		case 'k':
-			piece = BlackKing
-			p.king[Black] = sq
-		case '/':
-			sq -= 16
-		case '1', '2', '3', '4', '5', '6', '7', '8':
-			sq += int(char - '0')
+	// [0] - Pieces (entire board), starting with 8th rank.
+	ranks := strings.Split(fields[0], `/`)
+	if len(ranks) != 8 {
+		return nil, fmt.Errorf(`FEN board must have 8 ranks: '%s'`, fields[0])
+	}
+	for i, rank := range ranks {
+		col := 0
+		for _, char := range rank {
+			if char >= '1' && char <= '8' {
+				col += int(char - '0')
+				continue
+			}
+			index := strings.IndexRune(`PpNnBbRrQqKk`, char)
+			if index < 0 {
+				return nil, fmt.Errorf(`invalid piece '%c' on rank %d`, char, 8 - i)
+			}
+			if col < 8 {
+				p.pieces[square(7 - i, col)] = Piece(index + 2)
+			}
+			col++
 		}
-		if piece.some() {
-			p.pieces[sq] = piece
-			p.outposts[piece] |= bit[sq]
-			p.outposts[piece.color()] |= bit[sq]
-			p.balance += materialBalance[piece]
-			sq++
+		if col != 8 {
+			return nil, fmt.Errorf(`rank %d must have 8 squares: '%s'`, 8 - i, rank)
 		}
 	}
 
 	// [1] - Color of side to move.
-	p.color = let(matches[1] == `w`, White, Black)
+	switch fields[1] {
+	case `w`:
+		p.color = White
+	case `b`:
+		p.color = Black
+	default:
+		return nil, fmt.Errorf(`invalid side to move '%s'`, fields[1])
+	}
 
 	// [2] - Castle rights.
-	for _, char := range(matches[2]) {
-		switch(char) {
-		case 'K':
-			p.castles |= castleKingside[White]
-		case 'Q':
-			p.castles |= castleQueenside[White]
-		case 'k':
-			p.castles |= castleKingside[Black]
-		case 'q':
-			p.castles |= castleQueenside[Black]
-		case '-':
-			// No castling rights.
-		}
+	if err := p.setupCastles(fields[2]); err != nil {
+		return nil, err
 	}
 
 	// [3] - En-passant square.
-	if matches[3] != `-` {
-		p.enpassant = square(int(matches[3][1] - '1'), int(matches[3][0] - 'a'))
-
+	if ep := fields[3]; ep != `-` {
+		if len(ep) != 2 || ep[0] < 'a' || ep[0] > 'h' || ep[1] < '1' || ep[1] > '8' {
+			return nil, fmt.Errorf(`invalid en-passant square '%s'`, ep)
+		}
+		p.enpassant = square(int(ep[1] - '1'), int(ep[0] - 'a'))
 	}
 
 	// [4] - Number of half-moves.
-	if n, err := strconv.Atoi(matches[4]); err == nil {
+	if len(fields) > 4 {
+		n, err := strconv.Atoi(fields[4])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf(`invalid half-move clock '%s'`, fields[4])
+		}
 		p.count50 = n
 	}
 
-	p.reversible = true
+	// [5] - Number of full moves. Some programs start with zero so we let
+	// it slide.
+	if len(fields) > 5 {
+		n, err := strconv.Atoi(fields[5])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf(`invalid full move number '%s'`, fields[5])
+		}
+		p.fullmove = max(1, n)
+	}
+
+	return p.setup()
+}
+
+// Decodes castle rights of the FEN string and sets up the game's castle tables.
+// Besides regular "KQkq" the rights could be given in X-FEN or Shredder-FEN
+// used in Chess960: letters A-H (a-h for Black) specify the file of castling
+// rook, while K and Q stand for the outermost rook on that side of the king.
+func (p *Position) setupCastles(field string) error {
+	kings, rooks := standardCastling.king, standardCastling.rook
+
+	if field != `-` {
+		for _, char := range field {
+			color := let(char >= 'a', Black, White)
+			letter, home := byte(unicode.ToUpper(char)), A1 + 56 * color
+
+			// Castle rights follow the king on the back rank, if any.
+			kingFile := -1
+			for file := 0; file < 8; file++ {
+				if p.pieces[home + file] == king(color) {
+					kingFile, kings[color] = file, home + file
+				}
+			}
+
+			side := Kingside
+			switch {
+			case letter == 'K' || letter == 'Q':
+				if letter == 'Q' {
+					side = Queenside
+				}
+				// Look for the outermost rook starting from the edge of the
+				// board, or stick to the corner if there is none.
+				if kingFile >= 0 {
+					for file, step := let(side == Kingside, 7, 0), let(side == Kingside, -1, 1); file != kingFile; file += step {
+						if p.pieces[home + file] == rook(color) {
+							rooks[color][side] = home + file
+							break
+						}
+					}
+				}
+			case letter >= 'A' && letter <= 'H' && kingFile >= 0 && int(letter - 'A') != kingFile:
+				file := int(letter - 'A')
+				side = let(file > kingFile, Kingside, Queenside)
+				rooks[color][side] = home + file
+			default:
+				return fmt.Errorf(`invalid castle rights '%s'`, field)
+			}
+			p.castles |= castleFlag[color][side]
+		}
+	}
+	p.thread.game.castling = NewCastling(kings, rooks)
+
+	return nil
+}
+
+// Finishes position setup once the pieces are on the board.
+func (p *Position) setup() (*Position, error) {
+	for square, piece := range p.pieces {
+		if piece.some() {
+			p.outposts[piece] |= bit[square]
+			p.outposts[piece.color()] |= bit[square]
+			if piece.isKing() {
+				p.king[piece.color()] = square
+			}
+			p.balance += materialBalance[piece]
+		}
+	}
 	p.board = p.outposts[White] | p.outposts[Black]
+
+	// En-passant square must be right behind the enemy pawn that has just
+	// jumped over it. Donna only keeps the square if the pawn could actually
+	// be captured, the same way as NewPawnMove() does.
+	if ep := p.enpassant; ep != 0 {
+		if rank(p.color, ep) != A6H6 || p.pieces[ep].some() || p.pieces[ep + up[p.color]].some() || p.pieces[ep - up[p.color]] != pawn(p.color ^ 1) {
+			return nil, fmt.Errorf(`invalid en-passant square %c%d`, col(ep) + 'a', row(ep) + 1)
+		}
+		if (p.outposts[pawn(p.color)] & pawnAttacks[p.color ^ 1][ep]).empty() {
+			p.enpassant = 0
+		}
+	}
+
+	p.reversible = true
 	p.id, p.pawnId = p.polyglot()
 	p.tally = p.valuation()
 	p.score = Unknown
 
-	return p
+	return p, nil
+}
+
+// Returns an error if the position could not possibly occur in a game. This
+// is not part of the position setup since the tests often use partial positions,
+// ex. the ones without kings.
+func (p *Position) validate() error {
+	for color := White; color <= Black; color++ {
+		if count := p.outposts[king(color)].count(); count != 1 {
+			return fmt.Errorf(`%s must have one king, not %d`, C(color), count)
+		}
+		if p.outposts[pawn(color)].count() > 8 || p.outposts[color].count() > 16 {
+			return fmt.Errorf(`%s has too many pieces`, C(color))
+		}
+	}
+
+	if (p.outposts[Pawn] | p.outposts[BlackPawn]) & (maskRank[A1H1] | maskRank[A8H8]) != 0 {
+		return fmt.Errorf(`pawns can't be on the first or last rank`)
+	}
+
+	if p.isInCheck(p.color ^ 1) {
+		return fmt.Errorf(`%s king is in check while %s is to move`, C(p.color ^ 1), C(p.color))
+	}
+
+	castling := p.castling()
+	for color := White; color <= Black; color++ {
+		home := castling.king[color]
+		if p.castles & castleKingside[color] != 0 && (p.pieces[home] != king(color) || p.pieces[castling.rook[color][Kingside]] != rook(color)) {
+			return fmt.Errorf(`impossible kingside castle rights for %s`, C(color))
+		}
+		if p.castles & castleQueenside[color] != 0 && (p.pieces[home] != king(color) || p.pieces[castling.rook[color][Queenside]] != rook(color)) {
+			return fmt.Errorf(`impossible queenside castle rights for %s`, C(color))
+		}
+	}
+
+	return nil
 }
 
 // Computes initial values of position's polyglot hash and pawn hash. When
@@ -293,7 +405,7 @@ func (p *Position) status(move Move, blendedScore int) int {
 		defer func() { p = p.undoLastMove() }()
 	}
 
-	switch ply, score := ply(), abs(blendedScore); score {
+	switch ply, score := p.thread.ply(), abs(blendedScore); score {
 	case 0:
 		if ply == 1 {
 			if p.insufficient() {
@@ -321,11 +433,55 @@ func (p *Position) status(move Move, blendedScore int) int {
 	return InProgress
 }
 
+// Returns game status for the position: InProgress, WhiteWon or BlackWon when
+// the side to move is checkmated, or one of Stalemate, Insufficient, Repetition,
+// and FiftyMoves draws.
+func (p *Position) Status() int {
+	if !NewMoveGen(p).generateAllMoves().anyValid() {
+		if p.isInCheck(p.color) {
+			return let(p.color == White, BlackWon, WhiteWon)
+		}
+		return Stalemate
+	}
+
+	if p.insufficient() {
+		return Insufficient
+	} else if p.thirdRepetition() {
+		return Repetition
+	} else if p.fifty() {
+		return FiftyMoves
+	}
+
+	return InProgress
+}
+
+// Returns the side to move, i.e. White or Black.
+func (p *Position) Color() int {
+	return p.color
+}
+
+// Returns true if the side to move is in check.
+func (p *Position) InCheck() bool {
+	return p.isInCheck(p.color)
+}
+
+// Returns a list of all legal moves in the position.
+func (p *Position) LegalMoves() []Move {
+	return NewMoveGen(p).generateAllMoves().validOnly().allMoves()
+}
+
 // Encodes position as FEN string.
-func (p *Position) fen() (fen string) {
-	fancy := engine.fancy
-	engine.fancy = false; defer func() { engine.fancy = fancy }()
+func (p *Position) Fen() string {
+	return p.fen()
+}
 
+// Encodes position as DCF string (Donna Chess Format).
+func (p *Position) Dcf() string {
+	return p.dcf()
+}
+
+// Encodes position as FEN string.
+func (p *Position) fen() (fen string) {
 	// Board: start from A8->H8 going down to A1->H1.
 	empty := 0
 	for row := A8H8; row >= A1H1; row-- {
@@ -338,7 +494,7 @@ func (p *Position) fen() (fen string) {
 					fen += fmt.Sprintf(`%d`, empty)
 					empty = 0
 				}
-				fen += piece.String()
+				fen += piece.plain()
 			} else {
 				empty++
 			}
@@ -362,20 +518,28 @@ func (p *Position) fen() (fen string) {
 		fen += ` b`
 	}
 
-	// Castle rights for both sides, if any.
+	// Castle rights for both sides, if any. Chess960 castling rook that is
+	// not the outermost one is given by its file as X-FEN does.
 	if p.castles & 0x0F != 0 {
 		fen += ` `
-		if p.castles & castleKingside[White] != 0 {
-			fen += `K`
-		}
-		if p.castles & castleQueenside[White] != 0 {
-			fen += `Q`
-		}
-		if p.castles & castleKingside[Black] != 0 {
-			fen += `k`
-		}
-		if p.castles & castleQueenside[Black] != 0 {
-			fen += `q`
+		castling := p.castling()
+		for color := White; color <= Black; color++ {
+			for side := Kingside; side <= Queenside; side++ {
+				if p.castles & castleFlag[color][side] == 0 {
+					continue
+				}
+				home := castling.rook[color][side]
+				letter := byte(let(side == Kingside, 'K', 'Q'))
+				for file, step := col(home), let(side == Kingside, 1, -1); file >= 0 && file < 8; file += step {
+					if file != col(home) && p.pieces[square(row(home), file)] == rook(color) {
+						letter = byte(col(home)) + 'A'
+					}
+				}
+				if color == Black {
+					letter += 'a' - 'A'
+				}
+				fen += string(letter)
+			}
 		}
 	} else {
 		fen += ` -`
@@ -392,17 +556,14 @@ func (p *Position) fen() (fen string) {
 	// Number of half-moves (50 moves counter).
 	fen += fmt.Sprintf(` %d`, p.count50)
 
-	// TODO: Number of full moves.
-	fen += ` 1`
+	// Number of full moves.
+	fen += fmt.Sprintf(` %d`, p.fullmove)
 
 	return
 }
 
 // Encodes position as DCF string (Donna Chess Format).
 func (p *Position) dcf() string {
-	fancy := engine.fancy
-	engine.fancy = false; defer func() { engine.fancy = fancy }()
-
 	encode := func (square int) string {
 		var buffer bytes.Buffer
 
@@ -473,8 +634,10 @@ func (p *Position) String() string {
 		buffer.WriteByte('1' + byte(row))
 		for col := 0; col <= 7; col++ {
 			buffer.WriteByte(' ')
-			if piece := p.pieces[square(row, col)]; piece.some() {
-				buffer.WriteString(piece.String())
+			if piece := p.pieces[square(row, col)]; piece.some() && p.thread.game.engine.fancy {
+				buffer.WriteString(piece.fancy())
+			} else if piece.some() {
+				buffer.WriteString(piece.plain())
 			} else {
 				buffer.WriteString("\u22C5")
 			}
@@ -16,23 +16,32 @@ const (
 	cacheBeta  = uint8(2) // Lower bound.
 	cacheExact = uint8(cacheAlpha | cacheBeta)
 	cacheEntrySize = int(unsafe.Sizeof(CacheEntry{}))
+	cacheBucketSize = 4 // Entries per bucket: 4 * 16 = 64 bytes, i.e. one CPU cache line.
 )
 
 type CacheEntry struct {
-	id	uint16	// 2
-	move	Move	// +4 = 6
-	xscore	int16	// +2 = 8
-	xdepth	int8	// +1 = 9
-	flags	uint8	// +1 = 10
-	padding	uint8	// +1 = 11
+	id	uint32	// 4
+	move	Move	// +4 = 8
+	xscore	int16	// +2 = 10
+	xeval	int16	// +2 = 12
+	xdepth	int8	// +1 = 13
+	flags	uint8	// +1 = 14
+	padding	[2]uint8 // +2 = 16
 }
 
-type Cache []CacheEntry
+// Cache entries are grouped in buckets: the position's hash key picks the bucket
+// with its lower bits and identifies the entry within the bucket with the upper
+// 32 bits.
+type CacheBucket [cacheBucketSize]CacheEntry
 
-func cacheUsage() (hits int) {
+type Cache []CacheBucket
+
+func (game *Game) cacheUsage() (hits int) {
 	for i := 0; i < len(game.cache); i++ {
-		if game.cache[i].id != uint16(0) {
-			hits++
+		for j := 0; j < cacheBucketSize; j++ {
+			if game.cache[i][j].flags != cacheNone {
+				hits++
+			}
 		}
 	}
 
@@ -51,6 +60,11 @@ func (ce *CacheEntry) score(ply int) int {
 	return score
 }
 
+// Returns static evaluation of the position or Unknown.
+func (ce *CacheEntry) eval() int {
+	return int(ce.xeval)
+}
+
 func (ce *CacheEntry) depth() int {
 	return int(ce.xdepth)
 }
@@ -63,61 +77,107 @@ func (ce *CacheEntry) bounds() uint8 {
 	return ce.flags & 3
 }
 
-// Creates new or resets existing game cache (aka transposition table).
-func NewCache(megaBytes float64) Cache {
+// Returns how much the entry is worth keeping when another position needs its
+// place: empty entries go first, then the ones left by earlier searches, then
+// shallow ones. Exact scores are worth a bit more than bounds of the same depth.
+func (ce *CacheEntry) worth(token uint8) int {
+	if ce.flags == cacheNone {
+		return -1024
+	}
+	age := int(token - ce.token()) >> 2 // <-- Wraps around just like the token does.
+
+	return ce.depth() * 2 + let(ce.bounds() == cacheExact, 1, 0) - age * 16
+}
+
+// Returns the number of cache buckets that fit into given megabytes. It gets
+// rounded down to the power of 2 so that the hash key could be masked to pick
+// the bucket.
+func cacheBuckets(megaBytes float64) (size int) {
+	buckets := int(1024 * 1024 * megaBytes) / (cacheEntrySize * cacheBucketSize)
+	if buckets > 0 {
+		for size = 1; size * 2 <= buckets; size *= 2 {}
+	}
+
+	return size
+}
+
+// Creates new or resets existing cache (aka transposition table).
+func NewCache(megaBytes float64, existing Cache) Cache {
 	if megaBytes > 0.0 {
-		cacheSize := int(1024 * 1024 * megaBytes) / cacheEntrySize
-		// Cache size has changed.
-		if existing := len(game.cache); cacheSize != existing {
-			if existing == 0 {
-				// Create brand new zero-initialized cache.
-				return make(Cache, cacheSize)
-			} else {
-				// Reallocate existing cache (shrink or expand).
-				game.cache = append([]CacheEntry{}, game.cache[:cacheSize]...)
-			}
+		cacheSize := cacheBuckets(megaBytes)
+		// Cache size has changed: create brand new zero-initialized cache.
+		if cacheSize != len(existing) {
+			return make(Cache, cacheSize)
 		}
-		// Make sure the cache is all clear.
-		for i := 0; i < len(game.cache); i++ {
-			game.cache[i] = CacheEntry{}
+		// Make sure the existing cache is all clear.
+		for i := 0; i < len(existing); i++ {
+			existing[i] = CacheBucket{}
 		}
-		return game.cache
+		return existing
 	}
 
 	return nil
 }
 
-func (p *Position) cache(move Move, score, depth, ply int, flags uint8) *Position {
+// Stores the search results in the transposition table. The table is shared by
+// all search threads without any locking: the entries are small plain values
+// and an occasional mix-up of two concurrent writes is much cheaper than the
+// synchronization would be.
+//
+// The position takes the entry it already has in the bucket, or the one that
+// is worth the least. Its own entry gets updated unless it holds deeper results
+// of the current search, and the cached move and static evaluation are kept
+// when the new ones are not known.
+func (p *Position) cache(move Move, score, eval, depth, ply int, flags uint8) *Position {
+	game := p.thread.game
 	if cacheSize := len(game.cache); cacheSize > 0 {
-		index := p.id & uint64(cacheSize - 1)
-		entry := &game.cache[index]
-
-		if depth > entry.depth() || game.token != entry.token() {
-			if score >= matingIn(MaxPly) {
-				entry.xscore = int16(score + ply)
-			} else if score <= matedIn(MaxPly) {
-				entry.xscore = int16(score - ply)
-			} else {
-				entry.xscore = int16(score)
+		id, bucket := uint32(p.id >> 32), &game.cache[p.id & uint64(cacheSize - 1)]
+
+		entry := &bucket[0]
+		for i := 0; i < cacheBucketSize; i++ {
+			if bucket[i].id == id && bucket[i].flags != cacheNone {
+				entry = &bucket[i]
+				break
 			}
-			id := uint16(p.id >> 48)
-			if move.some() || id != entry.id {
-				entry.move = move
+			if bucket[i].worth(game.token) < entry.worth(game.token) {
+				entry = &bucket[i]
 			}
-			entry.xdepth = int8(depth)
-			entry.flags = flags | game.token
-			entry.id = id
 		}
+
+		if entry.id != id || entry.flags == cacheNone {
+			*entry = CacheEntry{ id: id, xeval: int16(Unknown) }
+		} else if depth < entry.depth() && flags != cacheExact && game.token == entry.token() {
+			return p
+		}
+
+		if score >= matingIn(MaxPly) {
+			entry.xscore = int16(score + ply)
+		} else if score <= matedIn(MaxPly) {
+			entry.xscore = int16(score - ply)
+		} else {
+			entry.xscore = int16(score)
+		}
+		if move.some() {
+			entry.move = move
+		}
+		if eval != Unknown {
+			entry.xeval = int16(eval)
+		}
+		entry.xdepth = int8(depth)
+		entry.flags = flags | game.token
 	}
 
 	return p
 }
 
 func (p *Position) probeCache() *CacheEntry {
+	game := p.thread.game
 	if cacheSize := len(game.cache); cacheSize > 0 {
-		index := p.id & uint64(cacheSize - 1)
-		if entry := &game.cache[index]; entry.id == uint16(p.id >> 48) {
-			return entry
+		id, bucket := uint32(p.id >> 32), &game.cache[p.id & uint64(cacheSize - 1)]
+		for i := 0; i < cacheBucketSize; i++ {
+			if entry := &bucket[i]; entry.id == id && entry.flags != cacheNone {
+				return entry
+			}
 		}
 	}
 
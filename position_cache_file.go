@@ -0,0 +1,155 @@
+// Copyright (c) 2014-2018 by Michael Dvorkin. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+//
+// I am making my contributions/submissions to this project solely in my
+// personal capacity and am not conveying any rights to any intellectual
+// property of any third parties.
+
+package donna
+
+import (
+	`bufio`
+	`encoding/binary`
+	`fmt`
+	`io`
+	`os`
+)
+
+// Cache file starts with the header followed by the cache entries, each one
+// packed into cacheRecordSize bytes. The version goes up whenever the layout
+// of the entries changes.
+const (
+	cacheFileMagic   = `DONNA-TT`
+	cacheFileVersion = 2
+	cacheRecordSize  = 14
+)
+
+// Cache file header: the fields are exported for binary.Read().
+type cacheFileHeader struct {
+	Magic    [8]byte
+	Version  uint16
+	Record   uint16 	// Size of the cache entry record in bytes.
+	Token    uint8 	// Cache token of the search that has been saved.
+	Padding  [3]uint8
+	Entries  uint64 	// Number of cache entries.
+}
+
+// Packs the cache entry into the record.
+func (ce *CacheEntry) encode(record []byte) {
+	binary.BigEndian.PutUint32(record[0:4], ce.id)
+	binary.BigEndian.PutUint32(record[4:8], uint32(ce.move))
+	binary.BigEndian.PutUint16(record[8:10], uint16(ce.xscore))
+	binary.BigEndian.PutUint16(record[10:12], uint16(ce.xeval))
+	record[12], record[13] = uint8(ce.xdepth), ce.flags
+}
+
+// Unpacks the cache entry from the record.
+func (ce *CacheEntry) decode(record []byte) {
+	ce.id = binary.BigEndian.Uint32(record[0:4])
+	ce.move = Move(binary.BigEndian.Uint32(record[4:8]))
+	ce.xscore = int16(binary.BigEndian.Uint16(record[8:10]))
+	ce.xeval = int16(binary.BigEndian.Uint16(record[10:12]))
+	ce.xdepth, ce.flags = int8(record[12]), record[13]
+}
+
+// Saves the engine's cache along with the given cache token to the file so
+// that the analysis could be resumed later.
+func (e *Engine) SaveCache(fileName string, token uint8) error {
+	if len(e.cache) == 0 {
+		return fmt.Errorf(`there is no hash to save`)
+	}
+
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriterSize(file, 1024 * 1024)
+	header := cacheFileHeader{ Version: cacheFileVersion, Record: cacheRecordSize, Token: token, Entries: uint64(len(e.cache) * cacheBucketSize) }
+	copy(header.Magic[:], cacheFileMagic)
+	if err = binary.Write(writer, binary.BigEndian, header); err != nil {
+		return err
+	}
+
+	var record [cacheRecordSize]byte
+	for i := range e.cache {
+		for j := range e.cache[i] {
+			e.cache[i][j].encode(record[:])
+			if _, err = writer.Write(record[:]); err != nil {
+				return err
+			}
+		}
+	}
+	if err = writer.Flush(); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+// Loads the engine's cache from the file and returns the cache token it was
+// saved with. The cache should be of the same size as the saved one. The next
+// new game keeps the loaded cache instead of clearing it, and its first search
+// reuses the saved token so that the loaded entries are not taken for stale
+// ones and overwritten by shallow searches.
+func (e *Engine) LoadCache(fileName string) (uint8, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var header cacheFileHeader
+	reader := bufio.NewReaderSize(file, 1024 * 1024)
+	if err = binary.Read(reader, binary.BigEndian, &header); err != nil || string(header.Magic[:]) != cacheFileMagic {
+		return 0, fmt.Errorf(`%s is not a hash file`, fileName)
+	}
+	if header.Version != cacheFileVersion || header.Record != cacheRecordSize {
+		return 0, fmt.Errorf(`unsupported hash file version %d`, header.Version)
+	}
+
+	if size := cacheBuckets(e.cacheSize) * cacheBucketSize; header.Entries != uint64(size) {
+		megabytes := float64(header.Entries) * float64(cacheEntrySize) / 1024 / 1024
+		return 0, fmt.Errorf(`hash file was saved with %.0fMB hash, current hash is %.0fMB`, megabytes, e.cacheSize)
+	}
+	if info, err := file.Stat(); err == nil && info.Size() != int64(binary.Size(header)) + int64(header.Entries) * cacheRecordSize {
+		return 0, fmt.Errorf(`hash file %s is truncated`, fileName)
+	}
+	if len(e.cache) * cacheBucketSize != int(header.Entries) {
+		e.cache = NewCache(e.cacheSize, e.cache) // Hash size has changed since the last game.
+	}
+
+	// Partially loaded cache gets cleared should reading fail halfway.
+	var record [cacheRecordSize]byte
+	for i := range e.cache {
+		for j := range e.cache[i] {
+			if _, err = io.ReadFull(reader, record[:]); err != nil {
+				e.cache = NewCache(e.cacheSize, e.cache)
+				return 0, err
+			}
+			e.cache[i][j].decode(record[:])
+		}
+	}
+	e.keepCache, e.cacheToken = true, header.Token - 4 // Search increments the token.
+
+	return header.Token, nil
+}
+
+// Saves the game's cache along with its current cache token.
+func (game *Game) SaveCache(fileName string) error {
+	return game.engine.SaveCache(fileName, game.token)
+}
+
+// Loads the cache the same way the engine's LoadCache() does, and resumes the
+// game with the loaded cache token.
+func (game *Game) LoadCache(fileName string) error {
+	_, err := game.engine.LoadCache(fileName)
+	if err == nil {
+		game.cache, game.token = game.engine.cache, game.engine.cacheToken
+		game.engine.keepCache, game.engine.cacheToken = false, 0 // The cache is already in use.
+	}
+
+	return err
+}
@@ -8,18 +8,150 @@
 
 package donna
 
-import(`github.com/michaeldv/donna/expect`; `testing`)
+import(`github.com/michaeldv/donna/expect`; `os`; `path/filepath`; `testing`)
 
 func TestCache000(t *testing.T) {
-	engine.cacheSize = 0.5
-	p := NewGame().start()
+	game := NewEngine(`cache`, 0.5).NewGame()
+	p := game.start()
 	move := NewMove(p, E2, E4)
-	p = p.makeMove(move).cache(move, 42, 1, 0, cacheExact)
+	p = p.makeMove(move).cache(move, 42, 12, 1, 0, cacheExact)
 
 	cached := p.probeCache()
 	expect.Eq(t, cached.move, move)
 	expect.Eq(t, cached.xscore, int16(42))
+	expect.Eq(t, cached.xeval, int16(12))
 	expect.Eq(t, cached.xdepth, int8(1))
 	expect.Eq(t, cached.flags, uint8(cacheExact | game.token))
-	expect.Eq(t, cached.id, uint16(p.id >> 48))
+	expect.Eq(t, cached.id, uint32(p.id >> 32))
+}
+
+// Replacement within the bucket: shallow and old entries go first.
+func TestCache010(t *testing.T) {
+	game := NewEngine(`cache`, 64.0 / 1024 / 1024).NewGame() // Single bucket.
+	p := game.start()
+	expect.Eq(t, len(game.cache), 1)
+
+	cached := func(san string) *CacheEntry {
+		position := p.makeMove(NewMoveFromSan(p, san))
+		defer position.undoLastMove()
+		return position.probeCache()
+	}
+	store := func(san string, depth int, flags uint8) {
+		position := p.makeMove(NewMoveFromSan(p, san))
+		position.cache(Move(0), 0, Unknown, depth, 1, flags).undoLastMove()
+	}
+
+	store(`a3`, 5, cacheBeta); store(`b3`, 3, cacheBeta); store(`c3`, 7, cacheBeta); store(`d3`, 4, cacheBeta)
+	expect.Eq(t, game.cacheUsage(), 4)
+	store(`e3`, 1, cacheExact)
+	expect.Eq(t, cached(`b3`), (*CacheEntry)(nil))
+	expect.Ne(t, cached(`e3`), (*CacheEntry)(nil))
+
+	// Entries of the new search push out old ones, even deeper ones.
+	game.token += 4
+	store(`f3`, 1, cacheBeta); store(`g3`, 1, cacheBeta)
+	expect.Eq(t, cached(`e3`), (*CacheEntry)(nil))
+	expect.Eq(t, cached(`d3`), (*CacheEntry)(nil))
+	expect.Ne(t, cached(`f3`), (*CacheEntry)(nil))
+	expect.Ne(t, cached(`c3`), (*CacheEntry)(nil))
+
+	// Same position: shallower bound is ignored, but exact score is not.
+	store(`f3`, 6, cacheBeta); store(`f3`, 2, cacheAlpha)
+	expect.Eq(t, cached(`f3`).depth(), 6)
+	store(`f3`, 2, cacheExact)
+	expect.Eq(t, cached(`f3`).depth(), 2)
+	expect.Eq(t, cached(`f3`).bounds(), cacheExact)
+}
+
+// Static evaluation gets cached.
+func TestCache020(t *testing.T) {
+	game := NewEngine(`cache`, 1, `depth`, 4).NewGame(`Ke1,Qd1,e4`, `Ke8,Qd8,d5`)
+	p := game.start()
+	game.Search()
+	p = p.makeMove(NewMoveFromSan(p, `exd5`))
+	cached := p.probeCache()
+	expect.Ne(t, cached, (*CacheEntry)(nil))
+	expect.Eq(t, cached.eval(), p.Evaluate())
+}
+
+// Saved cache is loaded back along with its token.
+func TestCache100(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), `donna.tt`)
+	engine := NewEngine(`cache`, 0.5)
+	game := engine.NewGame()
+	p := game.start()
+	move := NewMove(p, E2, E4)
+	game.token = 12
+	p = p.makeMove(move).cache(move, -42, 12, 7, 3, cacheBeta)
+	expect.Eq(t, game.SaveCache(fileName), nil)
+
+	engine = NewEngine(`cache`, 0.5)
+	token, err := engine.LoadCache(fileName)
+	expect.Eq(t, err, nil)
+	expect.Eq(t, token, uint8(12))
+
+	// Next game picks up the loaded cache, and its search reuses the token.
+	game = engine.NewGame()
+	p = game.start()
+	expect.Eq(t, game.getReady().token, uint8(12))
+	p = p.makeMove(NewMove(p, E2, E4))
+	cached := p.probeCache()
+	expect.Ne(t, cached, (*CacheEntry)(nil))
+	expect.Eq(t, cached.move, move)
+	expect.Eq(t, cached.score(3), -42)
+	expect.Eq(t, cached.depth(), 7)
+	expect.Eq(t, cached.eval(), 12)
+	expect.Eq(t, cached.bounds(), cacheBeta)
+
+	// The one after that starts from scratch.
+	game = engine.NewGame()
+	expect.Eq(t, game.token, uint8(0))
+	expect.Eq(t, game.cacheUsage(), 0)
+}
+
+// Version and size checks.
+func TestCache110(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), `donna.tt`)
+	expect.Eq(t, NewEngine(`cache`, 1).NewGame().SaveCache(fileName), nil)
+
+	_, err := NewEngine(`cache`, 2).LoadCache(fileName)
+	expect.Eq(t, err.Error(), `hash file was saved with 1MB hash, current hash is 2MB`)
+
+	content, _ := os.ReadFile(fileName)
+	os.WriteFile(fileName, content[:len(content) - 1], 0644)
+	_, err = NewEngine(`cache`, 1).LoadCache(fileName)
+	expect.Contain(t, err.Error(), `truncated`)
+
+	content[9] = 99 // Version.
+	os.WriteFile(fileName, content, 0644)
+	_, err = NewEngine(`cache`, 1).LoadCache(fileName)
+	expect.Eq(t, err.Error(), `unsupported hash file version 99`)
+
+	os.WriteFile(fileName, []byte(`Hello`), 0644)
+	_, err = NewEngine(`cache`, 1).LoadCache(fileName)
+	expect.Contain(t, err.Error(), `is not a hash file`)
+}
+
+// Resumed analysis picks up the loaded cache where the saved one has left off:
+// it gets the same results as the search continued in the original game, and
+// gets there several times faster than the first search did.
+func TestCache120(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), `donna.tt`)
+	fen := `r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4`
+
+	game := NewEngine(`cache`, 4, `depth`, 9).NewGame(fen)
+	game.start()
+	before := game.Search()
+	expect.Eq(t, game.SaveCache(fileName), nil)
+	game.token -= 4 // Continue with the same token as the resumed game does.
+	again := game.Search()
+
+	game = NewEngine(`cache`, 4, `depth`, 9).NewGame(fen)
+	expect.Eq(t, game.LoadCache(fileName), nil)
+	game.start()
+	after := game.Search()
+	expect.Eq(t, after.Move, again.Move)
+	expect.Eq(t, after.Score, again.Score)
+	expect.Eq(t, after.Pv, again.Pv)
+	expect.True(t, after.Nodes * 3 < before.Nodes)
 }
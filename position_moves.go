@@ -86,10 +86,15 @@ func (p *Position) makeMove(move Move) *Position {
 	from, to, piece, capture := move.split()
 
 	// Copy over the contents of previous tree node to the current one.
-	node++
-	tree[node] = *p // => tree[node] = tree[node - 1]
-	pp := &tree[node]
-
+	t := p.thread
+	t.node++
+	t.tree[t.node] = *p // => tree[node] = tree[node - 1]
+	pp := &t.tree[t.node]
+
+	// En-passant square, if any, is only good for one move.
+	if p.enpassant != 0 {
+		pp.id ^= hashEnpassant[p.enpassant & 7] // p.enpassant column.
+	}
 	pp.enpassant, pp.reversible = 0, true
 
 	if capture != 0 && (to == 0 || to != p.enpassant) {
@@ -101,7 +106,6 @@ func (p *Position) makeMove(move Move) *Position {
 		pp.count50, pp.reversible = 0, false
 		if to != 0 && to == p.enpassant {
 			pp.captureEnpassant(pawn(color^1), from, to)
-			pp.id ^= hashEnpassant[p.enpassant & 7] // p.enpassant column.
 		}
 		if promo := move.promo(); promo != 0 {
 			pp.promotePawn(piece, from, to, promo)
@@ -113,16 +117,24 @@ func (p *Position) makeMove(move Move) *Position {
 			}
 		}
 	} else if piece.isKing() {
-		pp.movePiece(piece, from, to)
 		pp.count50++
-		pp.king[color] = to
 		if move.isCastle() {
+			// The king takes its own rook. In Chess960 the king or the rook
+			// might stay put, or land on each other's home square.
 			pp.reversible = false
-			if to == from + 2 {
-				pp.movePiece(rook(color), to + 1, to - 1)
-			} else if to == from - 2 {
-				pp.movePiece(rook(color), to - 2, to + 1)
+			side := p.castling().side(color, from, to)
+			kingTo, rookTo := castleKingTarget[color][side], castleRookTarget[color][side]
+			if from != kingTo {
+				pp.movePiece(piece, from, kingTo)
 			}
+			if to != rookTo {
+				pp.movePiece(rook(color), to, rookTo)
+			}
+			pp.pieces[kingTo], pp.pieces[rookTo] = piece, rook(color)
+			pp.king[color] = kingTo
+		} else {
+			pp.movePiece(piece, from, to)
+			pp.king[color] = to
 		}
 	} else {
 		pp.movePiece(piece, from, to)
@@ -132,21 +144,41 @@ func (p *Position) makeMove(move Move) *Position {
 	// Set up the board bitmask, update castle rights, finish off incremental
 	// hash value, and flip the color.
 	pp.board = pp.outposts[White] | pp.outposts[Black]
-	pp.castles &= castleRights[from] & castleRights[to]
+	pp.castles &= p.castling().rights[from] & p.castling().rights[to]
 	pp.id ^= hashCastle[p.castles] ^ hashCastle[pp.castles]
 	pp.id ^= polyglotRandomWhite
 	pp.color ^= 1 // <-- Flip side to move.
 	pp.score = Unknown
+	if color == Black {
+		pp.fullmove++
+	}
 
-	return &tree[node] // pp
+	return pp
+}
+
+// Makes the move if it is legal in the position and returns new position, or
+// returns nil otherwise. The position must be the latest one in the game, and
+// the move gets recorded in the game's move list.
+func (p *Position) MakeMove(move Move) *Position {
+	if move.null() || !NewMoveGen(p).generateAllMoves().validOnly().amongValid(move) {
+		return nil
+	}
+
+	return p.thread.game.makeMove(move)
+}
+
+// Takes back the last move made in the game and returns previous position.
+func (p *Position) UndoLastMove() *Position {
+	return p.thread.game.undoLastMove()
 }
 
 // Makes "null" move by copying over previous node position (i.e. preserving all pieces
 // intact) and flipping the color.
 func (p *Position) makeNullMove() *Position {
-	node++
-	tree[node] = *p // => tree[node] = tree[node - 1]
-	pp := &tree[node]
+	t := p.thread
+	t.node++
+	t.tree[t.node] = *p // => tree[node] = tree[node - 1]
+	pp := &t.tree[t.node]
 
 	// Flipping side to move obviously invalidates the enpassant square.
 	if pp.enpassant != 0 {
@@ -157,15 +189,16 @@ func (p *Position) makeNullMove() *Position {
 	pp.color ^= 1 // <-- Flip side to move.
 	pp.count50++
 
-	return &tree[node] // pp
+	return pp
 }
 
 // Restores previous position effectively taking back the last move made.
 func (p *Position) undoLastMove() *Position {
-	if node > 0 {
-		node--
+	t := p.thread
+	if t.node > 0 {
+		t.node--
 	}
-	return &tree[node]
+	return &t.tree[t.node]
 }
 
 func (p *Position) isInCheck(color int) bool {
@@ -173,7 +206,8 @@ func (p *Position) isInCheck(color int) bool {
 }
 
 func (p *Position) isNull() bool {
-	return node > 0 && tree[node].board == tree[node-1].board
+	t := p.thread
+	return t.node > 0 && t.tree[t.node].board == t.tree[t.node-1].board
 }
 
 func (p *Position) fifty() bool {
@@ -181,15 +215,16 @@ func (p *Position) fifty() bool {
 }
 
 func (p *Position) repetition() bool {
-	if !p.reversible || node < 1 {
+	t := p.thread
+	if !p.reversible || t.node < 1 {
 		return false
 	}
 
-	for previous := node - 1; previous >= 0; previous-- {
-		if !tree[previous].reversible {
+	for previous := t.node - 1; previous >= 0; previous-- {
+		if !t.tree[previous].reversible {
 			return false
 		}
-		if tree[previous].id == p.id {
+		if t.tree[previous].id == p.id {
 			return true
 		}
 	}
@@ -198,15 +233,16 @@ func (p *Position) repetition() bool {
 }
 
 func (p *Position) thirdRepetition() bool {
-	if !p.reversible || node < 4 {
+	t := p.thread
+	if !p.reversible || t.node < 4 {
 		return false
 	}
 
-	for previous, repetitions := node - 2, 1; previous >= 0; previous -= 2 {
-		if !tree[previous].reversible || !tree[previous + 1].reversible {
+	for previous, repetitions := t.node - 2, 1; previous >= 0; previous -= 2 {
+		if !t.tree[previous].reversible || !t.tree[previous + 1].reversible {
 			return false
 		}
-		if tree[previous].id == p.id {
+		if t.tree[previous].id == p.id {
 			repetitions++
 			if repetitions == 3 {
 				return true
@@ -220,22 +256,42 @@ func (p *Position) thirdRepetition() bool {
 // Returns a pair of booleans that indicate whether given side is allowed to
 // castle kingside and queenside.
 func (p *Position) canCastle(color int) (kingside, queenside bool) {
+	castling := p.castling()
 
 	// Start off with simple checks.
-	kingside = (p.castles & castleKingside[color] != 0) && (gapKing[color] & p.board).empty()
-	queenside = (p.castles & castleQueenside[color] != 0) && (gapQueen[color] & p.board).empty()
+	kingside = (p.castles & castleKingside[color] != 0) && (castling.gap[color][Kingside] & p.board).empty()
+	queenside = (p.castles & castleQueenside[color] != 0) && (castling.gap[color][Queenside] & p.board).empty()
 
 	// If it still looks like the castles are possible perform more expensive
 	// final check.
 	if kingside || queenside {
 		attacks := p.allAttacks(color^1)
-		kingside = kingside && (castleKing[color] & attacks).empty()
-		queenside = queenside && (castleQueen[color] & attacks).empty()
+		kingside = kingside && (castling.safe[color][Kingside] & attacks).empty()
+		queenside = queenside && (castling.safe[color][Queenside] & attacks).empty()
+
+		// In Chess960 the castling rook might be the one shielding king's
+		// destination from enemy rook or queen along the back rank.
+		if castling.chess960 {
+			kingside = kingside && !p.castleExposed(color, Kingside)
+			queenside = queenside && !p.castleExposed(color, Queenside)
+		}
 	}
 
 	return kingside, queenside
 }
 
+// Returns true if the king gets attacked along the back rank once the castling
+// rook leaves its home square.
+func (p *Position) castleExposed(color, side int) bool {
+	castling := p.castling()
+	target := castleKingTarget[color][side]
+	board := p.board & ^bit[castling.king[color]] & ^bit[castling.rook[color][side]]
+	board |= bit[target] | bit[castleRookTarget[color][side]]
+	sliders := (p.outposts[rook(color^1)] | p.outposts[queen(color^1)]) & mask8th[color^1]
+
+	return (p.rookMovesAt(target, board) & sliders).any()
+}
+
 // Returns a bitmask of all pinned pieces preventing a check for the king on
 // given square. The color of the pieces match the color of the king.
 func (p *Position) pins(square int) (bitmask Bitmask) {
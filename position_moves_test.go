@@ -617,3 +617,15 @@ func TestPositionMoves410(t *testing.T) {
 	expect.True(t, position.isInCheck(position.color))
 	expect.True(t, position.isInCheck(p.color^1))
 }
+
+// En-passant square gets dropped from the hash when it's not captured.
+func TestPositionMoves420(t *testing.T) {
+	p := NewGame(`4k3/8/8/8/3p4/8/4P3/4K3 w - - 0 1`).start()
+	p = p.makeMove(NewPawnMove(p, E2, E4))
+	expect.Eq(t, p.enpassant, E3)
+	p = p.makeMove(NewMove(p, E8, D8))
+	expect.Eq(t, p.enpassant, 0)
+
+	hash, _ := p.polyglot()
+	expect.Eq(t, p.id, hash)
+}
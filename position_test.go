@@ -88,13 +88,13 @@ func TestPosition100(t *testing.T) {
 // Castles, no en-passant.
 func TestPosition110(t *testing.T) {
 	p := NewGame(`2r1kb1r/pp3ppp/2n1b3/1q1N2B1/1P2Q3/8/P4PPP/3RK1NR w Kk - 42 42`).start()
-	expect.Eq(t, p.fen(), `2r1kb1r/pp3ppp/2n1b3/1q1N2B1/1P2Q3/8/P4PPP/3RK1NR w Kk - 42 1`)
+	expect.Eq(t, p.fen(), `2r1kb1r/pp3ppp/2n1b3/1q1N2B1/1P2Q3/8/P4PPP/3RK1NR w Kk - 42 42`)
 }
 
 // No castles, en-passant.
 func TestPosition120(t *testing.T) {
 	p := NewGame(`1rr2k2/p1q5/3p2Q1/3Pp2p/8/1P3P2/1KPRN3/8 w - e6 42 42`).start()
-	expect.Eq(t, p.fen(), `1rr2k2/p1q5/3p2Q1/3Pp2p/8/1P3P2/1KPRN3/8 w - e6 42 1`)
+	expect.Eq(t, p.fen(), `1rr2k2/p1q5/3p2Q1/3Pp2p/8/1P3P2/1KPRN3/8 w - e6 42 42`)
 }
 
 //\\ Donna Chess Format (DCF) tests.
@@ -128,8 +128,8 @@ func TestPosition200(t *testing.T) {
 // Mate in 1 move.
 func TestPosition210(t *testing.T) {
 	p := NewGame(`Kf8,Rh1,g6`, `Kh8,Bg8,g7,h7`).start()
-	rootNode = node // Reset ply().
-	expect.Eq(t, p.status(NewMove(p, H1, H6), Checkmate - ply()), WhiteWinning)
+	p.thread.rootNode = p.thread.node // Reset ply().
+	expect.Eq(t, p.status(NewMove(p, H1, H6), Checkmate - p.thread.ply()), WhiteWinning)
 }
 
 // Forced stalemate.
@@ -159,7 +159,7 @@ func TestPosition240(t *testing.T) {
 	p = p.makeMove(NewMove(p, A1, A2))
 	p = p.makeMove(NewMove(p, H6, H5)) // -- No NewMove(p, A2, A1) here --
 
-	rootNode = node // Reset ply().
+	p.thread.rootNode = p.thread.node // Reset ply().
 	expect.Eq(t, p.status(NewMove(p, A2, A1), 0), Repetition) // <-- Ka2-a1 causes rep #3.
 }
 
@@ -189,3 +189,104 @@ func TestPosition310(t *testing.T) {
 	expect.Eq(t, p.Evaluate(), -319)
 
 }
+
+// Exported API.
+func TestPosition400(t *testing.T) {
+	p := NewGame().Start()
+	expect.Eq(t, p.Fen(), `rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1`)
+	expect.Eq(t, len(p.LegalMoves()), 20)
+	expect.Eq(t, p.Status(), InProgress)
+	expect.True(t, p.MakeMove(NewMove(p, E2, E5)) == nil)
+
+	p = p.MakeMove(NewMoveFromNotation(p, `e2e4`))
+	expect.Eq(t, p.Color(), Black)
+	expect.Eq(t, p.UndoLastMove().Color(), White)
+}
+
+func TestPosition410(t *testing.T) {
+	p := NewGame(`Kg6,Qg7`, `M,Kh8`).Start() // Checkmate.
+	expect.True(t, p.InCheck())
+	expect.Eq(t, p.Status(), WhiteWon)
+
+	p = NewGame(`Kf7,Qg5`, `M,Kh8`).Start()
+	expect.Eq(t, p.Status(), InProgress)
+	p = NewGame(`Kf7,Qg6`, `M,Kh8`).Start() // Stalemate.
+	expect.False(t, p.InCheck())
+	expect.Eq(t, p.Status(), Stalemate)
+}
+
+// Full move number in FEN and DCF.
+func TestPosition500(t *testing.T) {
+	game := NewGame(`rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1`)
+	p := game.start()
+	p = game.makeMove(NewMoveFromNotation(p, `e7e5`))
+	expect.Eq(t, p.fen(), `rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 2`)
+	p = game.makeMove(NewMoveFromNotation(p, `g1f3`))
+	expect.Eq(t, p.fen(), `rnbqkbnr/pppp1ppp/8/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - 1 2`)
+
+	p = NewGame(`Ke1,e4`, `M42,Ke8`).start()
+	expect.Eq(t, p.fen(), `4k3/8/8/8/4P3/8/8/4K3 b - - 0 42`)
+	p = NewGame(`4k3/8/8/8/4P3/8/8/4K3 w - -`).start()
+	expect.Eq(t, p.fen(), `4k3/8/8/8/4P3/8/8/4K3 w - - 0 1`)
+}
+
+// Explicit DCF castle rights.
+func TestPosition510(t *testing.T) {
+	p := NewGame(`Ke1,Ra1,Rh1,Cg1`, `Ke8,Ra8,Rh8,Cc8`).start()
+	expect.Eq(t, p.fen(), `r3k2r/8/8/8/8/8/8/R3K2R w Kq - 0 1`)
+	expect.Eq(t, p.dcf(), `Ke1,Ra1,Rh1,Cg1 : Ke8,Ra8,Rh8,Cc8`)
+
+	_, err := NewGame(`Ke1,Ra1,Cg1`, `Ke8`).setup()
+	expect.Eq(t, err.Error(), `impossible kingside castle rights for white`)
+	_, err = NewGame(`Ke1,Ce1`, `Ke8`).setup()
+	expect.Eq(t, err.Error(), `invalid castle square 'Ce1' for white`)
+	_, err = NewGame(`Ke1,Zz9`, `Ke8`).setup()
+	expect.Eq(t, err.Error(), `invalid notation 'Zz9' for white`)
+	_, err = NewGame(`Ke1,`, `Ke8`).setup()
+	expect.Eq(t, err.Error(), `missing piece for white in 'Ke1,'`)
+	_, err = NewGame(`Ke1`, `Mx,Ke8`).setup()
+	expect.Eq(t, err.Error(), `invalid move number 'Mx' for black`)
+}
+
+// Invalid FEN strings and illegal positions.
+func TestPosition520(t *testing.T) {
+	errors := map[string]string{
+		`4k3/8/8/8/8/8/8 w - - 0 1`:           `FEN board must have 8 ranks: '4k3/8/8/8/8/8/8'`,
+		`4k3/8/8/8/8/8/8/4K3`:                 `FEN must have 4 to 6 fields: '4k3/8/8/8/8/8/8/4K3'`,
+		`4k3/8/8/8/8/8/8/4K4 w - - 0 1`:       `rank 1 must have 8 squares: '4K4'`,
+		`4k3/8/8/8/8/8/8/4X3 w - - 0 1`:       `invalid piece 'X' on rank 1`,
+		`4k3/8/8/8/8/8/8/4K3 x - - 0 1`:       `invalid side to move 'x'`,
+		`4k3/8/8/8/8/8/8/4K3 w KX - 0 1`:      `invalid castle rights 'KX'`,
+		`4k3/8/8/8/8/8/8/4K3 w - e9 0 1`:      `invalid en-passant square 'e9'`,
+		`4k3/8/8/8/8/8/8/4K3 w - e6 0 1`:      `invalid en-passant square e6`,
+		`4k3/8/8/8/8/8/8/4K3 w - - x 1`:       `invalid half-move clock 'x'`,
+		`4k3/8/8/8/8/8/8/4K3 w - - 0 x`:       `invalid full move number 'x'`,
+		`4k3/8/8/8/8/8/8/8 w - - 0 1`:         `white must have one king, not 0`,
+		`4k3/8/8/8/8/8/8/3KK3 w - - 0 1`:      `white must have one king, not 2`,
+		`4k3/8/8/8/8/8/8/4K2P w - - 0 1`:      `pawns can't be on the first or last rank`,
+		`4k3/8/8/8/8/8/8/4R1K1 w - - 0 1`:     `black king is in check while white is to move`,
+		`4k3/8/8/8/8/8/8/4K3 w K - 0 1`:       `impossible kingside castle rights for white`,
+		`4k3/8/8/8/8/8/8/4K3 b q - 0 1`:       `impossible queenside castle rights for black`,
+	}
+	for fen, message := range errors {
+		_, err := NewGame(fen).setup()
+		expect.Eq(t, err.Error(), message)
+	}
+
+	// En-passant square is kept only when the pawn could be captured.
+	p, err := NewGame(`4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1`).setup()
+	expect.Eq(t, err, nil)
+	expect.Eq(t, p.enpassant, D6)
+	p, err = NewGame(`4k3/8/8/3p4/8/8/8/4K3 w - d6 0 1`).setup()
+	expect.Eq(t, err, nil)
+	expect.Eq(t, p.enpassant, 0)
+}
+
+// Pieces are shown as UTF-8 symbols by the engine that has been asked to.
+func TestPosition530(t *testing.T) {
+	fancy := NewEngine(`fancy`, true).NewGame(`Ke1`, `Ke8`).Start()
+	plain := NewEngine().NewGame(`Ke1`, `Ke8`).Start()
+	expect.Contain(t, fancy.String(), "♔")
+	expect.Contain(t, plain.String(), ` K `)
+	expect.NotContain(t, plain.String(), "♔")
+}
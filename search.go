@@ -11,7 +11,11 @@ package donna
 // Root node search. Basic principle is expressed by Boob's Law: you always find
 // something in the last place you look.
 func (p *Position) search(alpha, beta, depth int) (score int) {
-	ply, inCheck := ply(), p.isInCheck(p.color)
+	t := p.thread
+	engine := t.game.engine
+	ply, inCheck, isMain := t.ply(), p.isInCheck(p.color), t.id == 0
+	isSecondary := isMain && t.game.line > 0 // Second best MultiPV line or worse.
+	verbose := isMain && !isSecondary && engine.uci && !t.game.quiet
 
 	// Root move generator makes sure all generated moves are valid. The
 	// best move found so far is always the first one we search.
@@ -25,9 +29,13 @@ func (p *Position) search(alpha, beta, depth int) (score int) {
 	bestAlpha, bestScore := alpha, alpha
 	bestMove, moveCount := Move(0), 0
 	for move := gen.nextMove(); move.some(); move = gen.nextMove() {
+		if isSecondary && t.game.excluded(move) {
+			continue
+		}
+
 		position := p.makeMove(move)
-		moveCount++; game.nodes++
-		if engine.uci {
+		moveCount++; t.nodes++; t.checkNodes()
+		if verbose && since(t.game.started) >= 1000 { // Don't flood the GUI at low depths.
 			engine.uciMove(move, moveCount, depth)
 		}
 
@@ -36,14 +44,16 @@ func (p *Position) search(alpha, beta, depth int) (score int) {
 		newDepth := let(giveCheck && p.exchange(move) >= 0, depth, depth - 1)
 
 		// Start search with full window.
-		game.deepening = (moveCount == 1)
+		if isMain && !isSecondary {
+			t.game.deepening = (moveCount == 1)
+		}
 		if moveCount == 1 {
 			score = -position.searchTree(-beta, -alpha, newDepth)
 		} else {
 			reduction := 0
-			if !inCheck && !giveCheck && depth > 2 && move.isQuiet() && !move.isKiller(ply) && !move.isPawnAdvance() {
+			if !inCheck && !giveCheck && depth > 2 && move.isQuiet() && !t.isKiller(move, ply) && !move.isPawnAdvance() {
 				reduction = lateMoveReductions[(moveCount-1) & 63][depth & 63]
-				if game.history[move.piece()][move.to()] < 0 {
+				if t.history[move.piece()][move.to()] < 0 {
 					reduction++
 				}
 			}
@@ -63,16 +73,16 @@ func (p *Position) search(alpha, beta, depth int) (score int) {
 		position.undoLastMove()
 
 		// Don't touch anything if the time has elapsed and we need to abort th search.
-		if engine.clock.halt {
+		if engine.halted() {
 			return alpha
 		}
 
 		if moveCount == 1 || score > alpha {
 			bestMove = move
-			game.saveBest(0, move)
+			t.saveBest(0, move)
 			gen.scoreMove(depth, score).rearrangeRootMoves()
-			if moveCount > 1 {
-				game.volatility++
+			if isMain && !isSecondary && moveCount > 1 {
+				t.game.volatility++
 			}
 		} else {
 			gen.scoreMove(depth, -depth)
@@ -81,14 +91,16 @@ func (p *Position) search(alpha, beta, depth int) (score int) {
 		if score > bestScore {
 			bestScore = score
 			if score > alpha {
-				game.saveBest(ply, move)
+				t.saveBest(ply, move)
 				if score < beta {
 					alpha = score
 					bestMove = move
 				} else {
-					p.cache(move, score, depth, ply, cacheBeta)
-					if !inCheck && alpha > bestAlpha {
-						game.saveGood(depth, bestMove).updatePoor(depth, bestMove, gen.reset())
+					if !isSecondary {
+						p.cache(move, score, Unknown, depth, ply, cacheBeta)
+						if !inCheck && alpha > bestAlpha {
+							t.saveGood(depth, bestMove).updatePoor(depth, bestMove, gen.reset())
+						}
 					}
 					return score
 				}
@@ -99,25 +111,29 @@ func (p *Position) search(alpha, beta, depth int) (score int) {
 
 	if moveCount == 0 {
 		score = let(inCheck, -Checkmate, 0) // Mate if in check, stalemate otherwise.
-		if engine.uci {
+		if verbose {
 			engine.uciScore(depth, score, alpha, beta)
 		}
 		return score
 	}
 	score = bestScore
 
-	if !inCheck && alpha > bestAlpha {
-		game.saveGood(depth, bestMove).updatePoor(depth, bestMove, gen.reset())
-	}
+	// Secondary MultiPV lines leave the best moves out, so their results
+	// must not end up in the cache or move ordering tables.
+	if !isSecondary {
+		if !inCheck && alpha > bestAlpha {
+			t.saveGood(depth, bestMove).updatePoor(depth, bestMove, gen.reset())
+		}
 
-	cacheFlags := cacheAlpha
-	if score >= beta {
-		cacheFlags = cacheBeta
-	} else if bestMove.some() {
-		cacheFlags = cacheExact
+		cacheFlags := cacheAlpha
+		if score >= beta {
+			cacheFlags = cacheBeta
+		} else if bestMove.some() {
+			cacheFlags = cacheExact
+		}
+		p.cache(bestMove, score, Unknown, depth, ply, cacheFlags)
 	}
-	p.cache(bestMove, score, depth, ply, cacheFlags)
-	if engine.uci {
+	if verbose {
 		engine.uciScore(depth, score, alpha, beta)
 	}
 
@@ -130,22 +146,5 @@ func (p *Position) solve(depth int) Move {
 		NewRootGen(p, 1).generateRootMoves()
 	}
 	p.search(-Checkmate, Checkmate, depth)
-	return game.pv[0].moves[0]
-}
-
-func (p *Position) Perft(depth int) (total int64) {
-	if depth == 0 {
-		return 1
-	}
-
-	gen := NewGen(p, depth).generateAllMoves()
-	for move := gen.nextMove(); move != 0; move = gen.nextMove() {
-		if !move.valid(p, gen.pins) {
-			continue
-		}
-		position := p.makeMove(move)
-		total += position.Perft(depth - 1)
-		position.undoLastMove()
-	}
-	return
+	return p.thread.pv[0].moves[0]
 }
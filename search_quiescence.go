@@ -10,12 +10,15 @@ package donna
 
 // Quiescence search.
 func (p *Position) searchQuiescence(alpha, beta, depth int, inCheck bool) (score int) {
-	ply := ply()
+	t := p.thread
+	engine := t.game.engine
+	ply := t.ply()
 
 	// Return if it's time to stop search.
-	if ply >= MaxPly || engine.clock.halt {
+	if ply >= MaxPly || engine.halted() {
 		return p.Evaluate()
 	}
+	t.reach(ply)
 
 	// Insufficient material and repetition/perpetual check pruning.
 	if p.fifty() || p.insufficient() || p.repetition() {
@@ -34,7 +37,7 @@ func (p *Position) searchQuiescence(alpha, beta, depth int, inCheck bool) (score
 	isNull := p.isNull()
 	isPrincipal := (beta - alpha > 1)
 	if isPrincipal {
-		game.pv[ply].size = 0 // Reset principal variation.
+		t.pv[ply].size = 0 // Reset principal variation.
 	}
 
 	// Use fixed depth for caching.
@@ -52,21 +55,28 @@ func (p *Position) searchQuiescence(alpha, beta, depth int, inCheck bool) (score
 		}
 	}
 
+	eval := Unknown
 	if inCheck {
 		p.score = Unknown
 	} else {
 		if cached != nil {
 			if p.score == Unknown {
-				p.score = p.Evaluate()
+				if eval = cached.eval(); eval == Unknown {
+					eval = p.Evaluate()
+				}
+				p.score = eval
+			} else {
+				eval = p.score
 			}
 			bounds, score := cached.bounds(), cached.score(ply)
 			if (score > p.score && (bounds & cacheBeta != 0)) || (score <= p.score && (bounds & cacheAlpha != 0)) {
 				p.score = score
 			}
 		} else if isNull {
-			p.score = rightToMove.midgame * 2 - tree[node-1].score
+			p.score = rightToMove.midgame * 2 - t.tree[t.node-1].score
 		} else {
 			p.score = p.Evaluate()
+			eval = p.score
 		}
 
 		if p.score >= beta {
@@ -99,7 +109,7 @@ func (p *Position) searchQuiescence(alpha, beta, depth int, inCheck bool) (score
 		}
 
 		position := p.makeMove(move)
-		moveCount++; game.qnodes++
+		moveCount++; t.qnodes++; t.checkNodes()
 		giveCheck := position.isInCheck(position.color)
 
 		// Prune useless captures -- but make sure it's not a capture move that checks.
@@ -111,7 +121,7 @@ func (p *Position) searchQuiescence(alpha, beta, depth int, inCheck bool) (score
 		position.undoLastMove()
 
 		// Don't touch anything if the time has elapsed and we need to abort th search.
-		if engine.clock.halt {
+		if engine.halted() {
 			return alpha
 		}
 
@@ -119,13 +129,13 @@ func (p *Position) searchQuiescence(alpha, beta, depth int, inCheck bool) (score
 			bestScore = score
 			if score > alpha {
 				if isPrincipal {
-					game.saveBest(ply, move)
+					t.saveBest(ply, move)
 				}
 				if isPrincipal && score < beta {
 					alpha = score
 					bestMove = move
 				} else {
-					p.cache(move, score, newDepth, ply, cacheBeta)
+					p.cache(move, score, eval, newDepth, ply, cacheBeta)
 					return score
 				}
 			}
@@ -138,7 +148,7 @@ func (p *Position) searchQuiescence(alpha, beta, depth int, inCheck bool) (score
 	if isPrincipal && score > bestAlpha {
 		cacheFlags = cacheExact
 	}
-	p.cache(bestMove, score, newDepth, ply, cacheFlags)
+	p.cache(bestMove, score, eval, newDepth, ply, cacheFlags)
 
 	return score
 }
@@ -209,3 +209,115 @@ func TestSearch450(t *testing.T) {
 	position := NewGame().start()
 	expect.Eq(t, position.Perft(5), int64(4865609))
 }
+
+// Independent games searching at the same time.
+func TestSearch500(t *testing.T) {
+	alone := NewGame(`Kf8,Rh1,g6`, `Kh8,Bg8,g7,h7`).start().solve(5)
+
+	moves := make(chan Move)
+	for i := 0; i < 2; i++ {
+		go func() {
+			moves <- NewEngine(`cache`, 1).NewGame(`Kf8,Rh1,g6`, `Kh8,Bg8,g7,h7`).start().solve(5)
+		}()
+	}
+	expect.Eq(t, <-moves, alone)
+	expect.Eq(t, <-moves, alone)
+}
+
+func TestSearch510(t *testing.T) {
+	game := NewEngine(`depth`, 3).NewGame(`Kf8,Rh1,g6`, `Kh8,Bg8,g7,h7`)
+	game.Start()
+	result := game.Search()
+	expect.Eq(t, result.Move, `Rh1-h6`)
+	expect.Eq(t, result.Pv, `[Rh1-h6 g7xh6 g6-g7]`)
+	expect.Eq(t, result.Ponder, result.Pv[1])
+	expect.Eq(t, result.Mate, 2)
+	expect.Eq(t, result.Depth, 2) // Stops as soon as the mate is found.
+}
+
+// Node limited search stops at exactly given number of nodes.
+func TestSearch520(t *testing.T) {
+	game := NewEngine(`nodes`, 5000).NewGame()
+	game.Start()
+	expect.Eq(t, game.Search().Nodes, 5000)
+}
+
+func TestSearch530(t *testing.T) {
+	game := NewEngine(`nodes`, 5000, `threads`, 2).NewGame()
+	game.Start()
+	first := game.Search()
+	game.Start()
+	second := game.Search()
+	expect.Eq(t, first.Nodes, 5000)
+	expect.Eq(t, second.Move, first.Move)
+	expect.Eq(t, second.Score, first.Score)
+}
+
+// MultiPV lines start with different moves and are ranked by score.
+func TestSearch540(t *testing.T) {
+	game := NewEngine(`depth`, 4, `multipv`, 3).NewGame()
+	game.Start()
+	result := game.Search()
+	expect.Eq(t, len(game.lines), 3)
+	expect.Eq(t, game.lines[0].pv.moves[0], result.Move)
+	expect.True(t, game.lines[0].pv.moves[0] != game.lines[1].pv.moves[0])
+	expect.True(t, game.lines[1].pv.moves[0] != game.lines[2].pv.moves[0])
+	expect.True(t, game.lines[0].pv.moves[0] != game.lines[2].pv.moves[0])
+	expect.True(t, game.lines[0].score >= game.lines[1].score)
+	expect.True(t, game.lines[1].score >= game.lines[2].score)
+}
+
+// Secondary MultiPV lines leave root cache entry to the best line.
+func TestSearch545(t *testing.T) {
+	game := NewEngine(`depth`, 4, `multipv`, 3, `cache`, 1).NewGame()
+	p := game.Start()
+	result := game.Search()
+	cached := p.probeCache()
+	expect.Ne(t, cached, (*CacheEntry)(nil))
+	expect.Eq(t, cached.move, result.Move)
+}
+
+func TestSearch550(t *testing.T) {
+	game := NewEngine(`depth`, 2, `multipv`, 5).NewGame(`Kf8,Rh1,g6`, `Kh8,Bg8,g7,h7`)
+	game.Start()
+	game.Search()
+	expect.Eq(t, len(game.lines), 5)
+	expect.Eq(t, game.lines[0].pv.moves[0], `Rh1-h6`)
+}
+
+// Search restricted to given root moves.
+func TestSearch560(t *testing.T) {
+	game := NewEngine(`depth`, 4).NewGame(`Kf8,Rh1,g6`, `Kh8,Bg8,g7,h7`)
+	p := game.Start()
+	h2, _ := NewMoveFromString(p, `Rh1-h2`)
+	h3, _ := NewMoveFromString(p, `Rh1-h3`)
+	game.engine.options.searchMoves = []Move{ h2, h3 }
+	result := game.Search()
+	expect.True(t, result.Move == h2 || result.Move == h3)
+}
+
+// Selective depth goes beyond nominal depth.
+func TestSearch570(t *testing.T) {
+	game := NewEngine(`depth`, 5).NewGame()
+	game.Start()
+	game.Search()
+	expect.True(t, game.threads[0].seldepth > 5)
+}
+
+// Lazy SMP: helper threads share the cache but leave the depth limited search
+// result to the main thread.
+func TestSearch580(t *testing.T) {
+	single := NewEngine(`depth`, 4).NewGame(`Kg1,Rd1,f2,g2,h2`, `Kg8,Qd4,f7,g7,h7`)
+	single.Start()
+	expected := single.Search()
+
+	for _, threads := range []int{ 2, 4 } {
+		game := NewEngine(`depth`, 4, `threads`, threads).NewGame(`Kg1,Rd1,f2,g2,h2`, `Kg8,Qd4,f7,g7,h7`)
+		p := game.Start()
+		result := game.Search()
+		expect.True(t, NewMoveGen(p).generateMoves().amongValid(result.Move))
+		expect.Eq(t, result.Move, expected.Move)
+		expect.Eq(t, result.Score, expected.Score)
+		expect.Eq(t, result.Depth, 4)
+	}
+}
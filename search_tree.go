@@ -9,15 +9,18 @@
 package donna
 
 func (p *Position) searchTree(alpha, beta, depth int) (score int) {
-	ply := ply()
+	t := p.thread
+	engine := t.game.engine
+	ply := t.ply()
 
 	// Return if it's time to stop search.
-	if ply >= MaxPly || engine.clock.halt {
+	if ply >= MaxPly || engine.halted() {
 		return p.Evaluate()
 	}
+	t.reach(ply)
 
 	// Reset principal variation.
-	game.pv[ply].size = 0
+	t.pv[ply].size = 0
 
 	// Insufficient material and repetition/perpetual check pruning.
 	if p.fifty() || p.insufficient() || p.repetition() {
@@ -43,29 +46,38 @@ func (p *Position) searchTree(alpha, beta, depth int) (score int) {
 			bounds, score := cached.bounds(), cached.score(ply)
 			if (score >= beta && (bounds & cacheBeta != 0)) || (score <= alpha && (bounds & cacheAlpha != 0)) {
 				if score >= beta && !inCheck && cachedMove.some() {
-					game.saveGood(depth, cachedMove)
+					t.saveGood(depth, cachedMove)
 				}
 				return score
 			}
 		}
 	}
 
+	// Static evaluation gets cached along with the search results so that
+	// it doesn't have to be recomputed on cache hits.
+	eval := Unknown
 	if !inCheck {
 		if depth < 1 {
 			return p.searchQuiescence(alpha, beta, 0, inCheck)
 		}
 		if cached != nil {
 			if p.score == Unknown {
-				p.score = p.Evaluate()
+				if eval = cached.eval(); eval == Unknown {
+					eval = p.Evaluate()
+				}
+				p.score = eval
+			} else {
+				eval = p.score
 			}
 			bounds, score := cached.bounds(), cached.score(ply)
 			if (score > p.score && (bounds & cacheBeta != 0)) || (score <= p.score && (bounds & cacheAlpha != 0)) {
 				p.score = score
 			}
 		} else if isNull {
-			p.score = rightToMove.midgame * 2 - tree[node-1].score
+			p.score = rightToMove.midgame * 2 - t.tree[t.node-1].score
 		} else {
 			p.score = p.Evaluate()
+			eval = p.score
 		}
 	}
 
@@ -102,9 +114,12 @@ func (p *Position) searchTree(alpha, beta, depth int) (score int) {
 		// Null move pruning.
 		if !isNull && depth > 1 && p.outposts[p.color].count() > 5 {
 			position := p.makeNullMove()
-			game.nodes++
+			t.nodes++; t.checkNodes()
 			nullScore := -position.searchTree(-beta, -beta + 1, depth - 1 - 3)
 			position.undoLastMove()
+			if engine.halted() {
+				return alpha
+			}
 
 			if nullScore >= beta {
 				if isMate(nullScore) {
@@ -122,6 +137,9 @@ func (p *Position) searchTree(alpha, beta, depth int) (score int) {
 			newDepth = depth - 2
 		}
 		p.searchTree(alpha, beta, newDepth)
+		if engine.halted() {
+			return alpha
+		}
 		if cached := p.probeCache(); cached != nil {
 			cachedMove = cached.move
 		}
@@ -142,7 +160,7 @@ func (p *Position) searchTree(alpha, beta, depth int) (score int) {
 		}
 
 		position := p.makeMove(move)
-		moveCount++; game.nodes++
+		moveCount++; t.nodes++; t.checkNodes()
 
 		// Reduce search depth if we're not checking.
 		giveCheck := position.isInCheck(position.color)
@@ -153,17 +171,17 @@ func (p *Position) searchTree(alpha, beta, depth int) (score int) {
 			score = -position.searchTree(-beta, -alpha, newDepth)
 		} else {
 			reduction := 0
-			if !inCheck && !giveCheck && depth > 2 && move.isQuiet() && !move.isKiller(ply) && !move.isPawnAdvance() {
+			if !inCheck && !giveCheck && depth > 2 && move.isQuiet() && !t.isKiller(move, ply) && !move.isPawnAdvance() {
 				reduction = lateMoveReductions[(moveCount-1) & 63][depth & 63]
 				if isPrincipal {
 					reduction /= 2
 				} else {
 					// Reduce more if the score is not improving.
-					if node > 1 && bestScore < tree[node-2].score && tree[node-2].score != Unknown {
+					if t.node > 1 && bestScore < t.tree[t.node-2].score && t.tree[t.node-2].score != Unknown {
 						reduction++
 					}
 					// Reduce more for weak queit moves.
-					if move.isQuiet() && game.history[move.piece()][move.to()] < 0 {
+					if move.isQuiet() && t.history[move.piece()][move.to()] < 0 {
 						reduction++
 					}
 				}
@@ -184,7 +202,7 @@ func (p *Position) searchTree(alpha, beta, depth int) (score int) {
 		position.undoLastMove()
 
 		// Don't touch anything if the time has elapsed and we need to abort th search.
-		if engine.clock.halt {
+		if engine.halted() {
 			return alpha
 		}
 
@@ -192,13 +210,13 @@ func (p *Position) searchTree(alpha, beta, depth int) (score int) {
 			bestScore = score
 			if score > alpha {
 				if isPrincipal {
-					game.saveBest(ply, move)
+					t.saveBest(ply, move)
 				}
 				if isPrincipal && score < beta {
 					alpha = score
 					bestMove = move
 				} else {
-					p.cache(move, score, depth, ply, cacheBeta)
+					p.cache(move, score, eval, depth, ply, cacheBeta)
 					return score
 				}
 			}
@@ -210,7 +228,7 @@ func (p *Position) searchTree(alpha, beta, depth int) (score int) {
 	} else {
 		score = bestScore
 		if !inCheck {
-			game.saveGood(depth, bestMove)
+			t.saveGood(depth, bestMove)
 		}
 	}
 
@@ -220,7 +238,7 @@ func (p *Position) searchTree(alpha, beta, depth int) (score int) {
 	} else if isPrincipal && bestMove.some() {
 		cacheFlags = cacheExact
 	}
-	p.cache(bestMove, score, depth, ply, cacheFlags)
+	p.cache(bestMove, score, eval, depth, ply, cacheFlags)
 
 	return score
 }
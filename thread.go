@@ -0,0 +1,151 @@
+// Copyright (c) 2014-2018 by Michael Dvorkin. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+//
+// I am making my contributions/submissions to this project solely in my
+// personal capacity and am not conveying any rights to any intellectual
+// property of any third parties.
+
+package donna
+
+// Search thread state. The main thread (id 0) drives iterative deepening and
+// reports the results, while helper threads search the same root position in
+// parallel sharing the game's transposition table (aka Lazy SMP). Each thread
+// owns everything it writes to during the search so that the threads never
+// step on each other's toes.
+type Thread struct {
+	id          int                 // Thread number, 0 for the main thread.
+	game        *Game               // Game the thread is searching for.
+	node        int                 // Current node in the position tree.
+	rootNode    int                 // Root node of the search.
+	nodes       int                 // Number of regular nodes searched.
+	qnodes      int                 // Number of quiescence nodes searched.
+	seldepth    int                 // Maximum ply reached by the search.
+	history     History             // Good moves history.
+	killers     Killers             // Killer moves.
+	pv          Pv                  // Principal variations for each ply.
+	eval        Evaluation          // Position evaluation scratchpad.
+	pawnCache   PawnCache           // Cache of pawn structures.
+	moveList    [MaxPly+1]MoveGen   // Move generators, one per ply.
+	tree        [1024]Position      // Stack of positions, one per node.
+}
+
+func NewThread(game *Game, id int) *Thread {
+	return &Thread{ id: id, game: game }
+}
+
+// Returns a distance between current node and the root one.
+func (t *Thread) ply() int {
+	return t.node - t.rootNode
+}
+
+func (t *Thread) position() *Position {
+	return &t.tree[t.node]
+}
+
+// Resets principal variation as well as killer moves, move history, and node
+// counts. Root node gets set to the current tree node to match the position.
+func (t *Thread) getReady() *Thread {
+	t.pv = Pv{}
+	t.killers = Killers{}
+	t.history = History{}
+	t.nodes, t.qnodes, t.seldepth = 0, 0, 0
+	t.rootNode = t.node
+
+	return t
+}
+
+// Copies position stack of another thread (the positions preceding the root
+// are needed to detect repetitions) and makes the copies ours.
+func (t *Thread) copyTree(other *Thread) *Thread {
+	copy(t.tree[0:other.node + 1], other.tree[0:other.node + 1])
+	for i := 0; i <= other.node; i++ {
+		t.tree[i].thread = t
+	}
+	t.node = other.node
+
+	return t
+}
+
+// Helper thread's own iterative deepening. Odd helpers skip ahead one ply so
+// that the threads do not search the same depths in lockstep. The results are
+// never reported: helpers only feed the shared cache that the main thread then
+// benefits from.
+func (t *Thread) assist() {
+	p := t.position()
+	NewRootGen(p, 1).generateRootMoves()
+
+	for depth := 1 + t.id & 1; depth <= MaxDepth && !t.game.engine.halted(); depth++ {
+		p.search(-Checkmate, Checkmate, depth)
+	}
+}
+
+// Halts node limited search as soon as the thread has visited the requested
+// number of nodes. The main thread also lets the GUI know it's still alive
+// every now and then.
+func (t *Thread) checkNodes() {
+	nodes := t.nodes + t.qnodes
+	if engine := t.game.engine; engine.fixedNodes() && nodes >= engine.options.maxNodes {
+		engine.clock.halt.Store(true)
+	}
+	if t.id == 0 && nodes & 0xFFFF == 0 {
+		t.game.heartbeat()
+	}
+}
+
+// Keeps track of the maximum ply reached by the search.
+func (t *Thread) reach(ply int) *Thread {
+	if ply > t.seldepth {
+		t.seldepth = ply
+	}
+
+	return t
+}
+
+func (t *Thread) saveBest(ply int, move Move) *Thread {
+	t.pv[ply].moves[ply] = move
+	t.pv[ply].size = ply + 1
+
+	next := t.pv[ply].size
+	if size := t.pv[next].size; next < MaxPly && size > next {
+		copy(t.pv[ply].moves[next:], t.pv[next].moves[next:size])
+		t.pv[ply].size += size - next
+	}
+
+	return t
+}
+
+func (t *Thread) saveGood(depth int, move Move) *Thread {
+	if move.isQuiet() {
+		if ply := t.ply(); move != t.killers[ply][0] {
+			t.killers[ply][1] = t.killers[ply][0]
+			t.killers[ply][0] = move
+		}
+		t.history[move.piece()][move.to()] += depth * depth
+	}
+
+	return t
+}
+
+func (t *Thread) updatePoor(depth int, bestMove Move, mgen *MoveGen) *Thread {
+	value := depth * depth
+
+	for move := mgen.nextMove(); move != 0; move = mgen.nextMove() {
+		if move.isQuiet() {
+			t.history[move.piece()][move.to()] = let(move == bestMove, value, -value)
+		}
+	}
+
+	return t
+}
+
+// Checks whether the move is among good moves captured so far and returns its
+// history value.
+func (t *Thread) good(move Move) int {
+	return t.history[move.piece()][move.to()]
+}
+
+// Returns true is the move is one of the killer moves at given ply.
+func (t *Thread) isKiller(move Move, ply int) bool {
+	return move.some() && (move == t.killers[ply][0] || move == t.killers[ply][1])
+}
@@ -66,11 +66,6 @@ func same(square int) Bitmask {
 	return ^maskDark
 }
 
-// Returns a distance between current node and the root one.
-func ply() int {
-	return node - rootNode
-}
-
 // Returns a score of getting mated in given number of plies.
 func matedIn(ply int) int {
 	return ply - Checkmate
@@ -133,23 +128,28 @@ func since(start time.Time) int64 {
 }
 
 // Returns nodes per second search speed for the given time duration.
-func nps(duration int64) int64 {
-	nodes := int64(game.nodes + game.qnodes) * 1000
+func (game *Game) nps(duration int64) int64 {
+	regular, quiescence := game.totals()
+	nodes := int64(regular + quiescence) * 1000
 	if duration != 0 {
 		return nodes / duration
 	}
 	return nodes
 }
 
-// Returns a number of used items in a sample of 1000 cache entries.
-func hashfull() int {
-	count := 0
+// Returns a number of items used by the current search in a sample of 1000
+// cache entries, i.e. 250 cache buckets.
+func (game *Game) hashfull() int {
+	count, sample := 0, 1000 / cacheBucketSize
 
-	if cacheSize := len(game.cache); cacheSize > 1000 {
-		start := (game.nodes + game.qnodes) % (cacheSize - 1000) // 0 <= start < cacheSize - 1000.
-		for i := start; i < start + 1000; i++ {
-			if game.cache[i].token() == game.token {
-				count++
+	if cacheSize := len(game.cache); cacheSize > sample {
+		regular, quiescence := game.totals()
+		start := (regular + quiescence) % (cacheSize - sample) // 0 <= start < cacheSize - sample.
+		for i := start; i < start + sample; i++ {
+			for j := 0; j < cacheBucketSize; j++ {
+				if entry := &game.cache[i][j]; entry.flags != cacheNone && entry.token() == game.token {
+					count++
+				}
 			}
 		}
 	}
@@ -209,26 +209,28 @@ func Summary(metrics map[string]interface{}) {
 }
 
 // Logging wrapper around fmt.Printf() that could be turned on as needed. Typical
-// usage is Log(); defer Log() in tests.
-func Log(args ...interface{}) {
+// usage is game.engine.Log(); defer game.engine.Log() in tests.
+func (e *Engine) Log(args ...interface{}) *Engine {
 	switch len(args) {
 	case 0:
 		// Calling Log() with no arguments flips the logging setting.
-		engine.log = !engine.log
-		engine.fancy = !engine.fancy
+		e.logging = !e.logging
+		e.fancy = !e.fancy
 	case 1:
 		switch args[0].(type) {
 		case bool:
-			engine.log = args[0].(bool)
-			engine.fancy = args[0].(bool)
+			e.logging = args[0].(bool)
+			e.fancy = args[0].(bool)
 		default:
-			if engine.log {
+			if e.logging {
 				fmt.Println(args...)
 			}
 		}
 	default:
-		if engine.log {
+		if e.logging {
 			fmt.Printf(args[0].(string), args[1:]...)
 		}
 	}
+
+	return e
 }